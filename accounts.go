@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/icedream/irc-medialink/manager"
+)
+
+// whoxToken is the query type we send along with our WHOX requests to
+// recognize the replies.
+const whoxToken = "152"
+
+// antifloodIdentity returns what antiflood should know a user by: their
+// services account if the server keeps us updated about it, otherwise their
+// hostmask.
+func antifloodIdentity(caps *capNegotiator, source, account string) string {
+	if len(account) > 0 && caps.Enabled("extended-join") && caps.Enabled("account-notify") {
+		return manager.AccountIdentity(account)
+	}
+	return source
+}
+
+// accountLookup resolves the services account of users via WHOIS.
+type accountLookup struct {
+	lock    sync.Mutex
+	pending map[string][]chan string
+	results map[string]string
+}
+
+func newAccountLookup() *accountLookup {
+	return &accountLookup{
+		pending: map[string][]chan string{},
+		results: map[string]string{},
+	}
+}
+
+// Lookup returns the services account the given nickname is logged in to or
+// an empty string if they are not logged in. The whois function is called to
+// send the WHOIS request if no other lookup for this nickname is running.
+func (l *accountLookup) Lookup(ctx context.Context, nick string, whois func(nick string)) (string, error) {
+	key := foldName(nick)
+	result := make(chan string, 1)
+
+	l.lock.Lock()
+	waiters, isRunning := l.pending[key]
+	l.pending[key] = append(waiters, result)
+	l.lock.Unlock()
+
+	if !isRunning {
+		whois(nick)
+	}
+
+	select {
+	case account := <-result:
+		return account, nil
+	case <-ctx.Done():
+		l.lock.Lock()
+		waiters := l.pending[key]
+		for i, waiter := range waiters {
+			if waiter == result {
+				l.pending[key] = append(waiters[0:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(l.pending[key]) == 0 {
+			delete(l.pending, key)
+			delete(l.results, key)
+		}
+		l.lock.Unlock()
+		return "", ctx.Err()
+	}
+}
+
+// SetAccount is called when the server tells us which account the given
+// nickname is logged in to (RPL_WHOISACCOUNT).
+func (l *accountLookup) SetAccount(nick, account string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	key := foldName(nick)
+	if _, ok := l.pending[key]; ok {
+		l.results[key] = account
+	}
+}
+
+// Finish is called when the server has sent all WHOIS information about the
+// given nickname (RPL_ENDOFWHOIS) or the nickname does not exist.
+func (l *accountLookup) Finish(nick string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	key := foldName(nick)
+	account := l.results[key]
+	for _, waiter := range l.pending[key] {
+		waiter <- account
+	}
+	delete(l.pending, key)
+	delete(l.results, key)
+}
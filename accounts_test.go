@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AccountLookup(t *testing.T) {
+	l := newAccountLookup()
+
+	whoisCalls := make(chan string, 2)
+	whois := func(nick string) { whoisCalls <- nick }
+
+	results := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			account, err := l.Lookup(context.Background(), "Someone", whois)
+			assert.NoError(t, err)
+			results <- account
+		}()
+	}
+
+	// Only one WHOIS must be sent for concurrent lookups
+	require.Equal(t, "Someone", <-whoisCalls)
+	require.Eventually(t, func() bool {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		return len(l.pending[foldName("someone")]) == 2
+	}, time.Second, time.Millisecond)
+	assert.Empty(t, whoisCalls)
+
+	l.SetAccount("SOMEONE", "someaccount")
+	l.Finish("someone")
+	assert.Equal(t, "someaccount", <-results)
+	assert.Equal(t, "someaccount", <-results)
+
+	// Users that are not logged in have no account
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	account, err := l.Lookup(ctx, "nobody", func(nick string) { l.Finish(nick) })
+	require.NoError(t, err)
+	assert.Empty(t, account)
+}
+
+func Test_AccountLookup_Timeout(t *testing.T) {
+	l := newAccountLookup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := l.Lookup(ctx, "Someone", func(string) {})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, l.pending)
+}
+
+func Test_AntifloodIdentity(t *testing.T) {
+	caps := newCapNegotiator("account-notify", "extended-join")
+	assert.Equal(t, "nick!user@host", antifloodIdentity(caps, "nick!user@host", "account"))
+
+	caps.Handle([]string{"bot", "LS", "account-notify extended-join"})
+	caps.Handle([]string{"bot", "ACK", "account-notify extended-join"})
+	assert.Equal(t, "$a:account", antifloodIdentity(caps, "nick!user@host", "account"))
+	assert.Equal(t, "nick!user@host", antifloodIdentity(caps, "nick!user@host", ""))
+}
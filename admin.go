@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/icedream/irc-medialink/manager"
+)
+
+// adminConn describes the methods of the IRC connection that admin commands
+// need.
+type adminConn interface {
+	ircReplier
+	Join(channel string)
+	SendRawf(format string, a ...interface{})
+	Whois(nick string)
+}
+
+// adminCommands implements the commands the owners of this bot instance can
+// send via private message.
+type adminCommands struct {
+	conn     adminConn
+	manager  *manager.Manager
+	settings *settingsStore
+	accounts *accountLookup
+
+	// ownerAccounts contains the services accounts allowed to use admin
+	// commands.
+	ownerAccounts []string
+	// lookupTimeout limits how long we wait for the server to tell us the
+	// account of a user.
+	lookupTimeout time.Duration
+	startTime     time.Time
+
+	// Restart is called to initiate a graceful restart of the bot.
+	Restart func(reason string)
+
+	// KnownAccount returns the account of a user if we are kept up to date
+	// about it, saving us a WHOIS.
+	KnownAccount func(nick string) (account string, ok bool)
+}
+
+// isOwner checks whether the user who sent the command is logged in to one
+// of the owner accounts.
+func (a *adminCommands) isOwner(cmd *commandContext) bool {
+	if len(a.ownerAccounts) == 0 {
+		return false
+	}
+
+	account, ok := "", false
+	if a.KnownAccount != nil {
+		account, ok = a.KnownAccount(cmd.Nick)
+	}
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), a.lookupTimeout)
+		defer cancel()
+		var err error
+		account, err = a.accounts.Lookup(ctx, cmd.Nick, a.conn.Whois)
+		if err != nil {
+			log.Printf("WARNING: Could not look up account of %s: %s", cmd.Nick, err.Error())
+			return false
+		}
+	}
+	if len(account) == 0 {
+		return false
+	}
+
+	for _, ownerAccount := range a.ownerAccounts {
+		if isSameName(ownerAccount, account) {
+			return true
+		}
+	}
+	return false
+}
+
+// Register adds all admin commands to the given command registry.
+func (a *adminCommands) Register(r *commandRegistry) {
+	a.register(r, "join", "<channel> [<key>]", a.join)
+	a.register(r, "part", "<channel> [<reason>]", a.part)
+	a.register(r, "reload", "", a.reload)
+	a.register(r, "stats", "", a.stats)
+	a.register(r, "clearcache", "", a.clearCache)
+	a.register(r, "ignore", "[<nick>|<nick!user@host>|$a:<account>]", a.ignore)
+	a.register(r, "unignore", "<nick>|<nick!user@host>|$a:<account>", a.unignore)
+	a.register(r, "restart", "[<reason>]", a.restart)
+}
+
+func (a *adminCommands) register(r *commandRegistry, name string, usage string, handler func(cmd *commandContext) error) {
+	r.Register(name, func(cmd *commandContext) {
+		if cmd.IsChannel {
+			return
+		}
+		// Checked before the owner since that may require a WHOIS
+		if a.manager.TrackAdminCommand(cmd.Source) {
+			log.Printf("Ignoring admin command %s from %s due to rate limit", cmd.Name, cmd.Source)
+			return
+		}
+		if !a.isOwner(cmd) {
+			log.Printf("Denied admin command %s from %s", cmd.Name, cmd.Source)
+			a.conn.Notice(cmd.Nick, "Only the owners of this bot are allowed to do this. Make sure you are logged in to your account.")
+			return
+		}
+
+		log.Printf("Running admin command %s for %s", cmd.Name, cmd.Source)
+		if err := handler(cmd); err == errUsage {
+			a.conn.Noticef(cmd.Nick, "Usage: %s %s", strings.ToUpper(name), usage)
+		} else if err != nil {
+			log.Printf("WARNING: Admin command %s failed: %s", cmd.Name, err.Error())
+			a.conn.Noticef(cmd.Nick, "Failed: %s", err.Error())
+		}
+	})
+}
+
+func (a *adminCommands) join(cmd *commandContext) error {
+	if len(cmd.Args) < 1 || !isChannelName(cmd.Args[0]) {
+		return errUsage
+	}
+
+	if len(cmd.Args) > 1 {
+		a.conn.Join(cmd.Args[0] + " " + cmd.Args[1])
+	} else {
+		a.conn.Join(cmd.Args[0])
+	}
+	a.conn.Noticef(cmd.Nick, "Joining %s.", cmd.Args[0])
+	return nil
+}
+
+func (a *adminCommands) part(cmd *commandContext) error {
+	if len(cmd.Args) < 1 || !isChannelName(cmd.Args[0]) {
+		return errUsage
+	}
+
+	reason := strings.TrimSpace(strings.TrimPrefix(cmd.ArgLine, cmd.Args[0]))
+	if len(reason) > 0 {
+		a.conn.SendRawf("PART %s :%s", cmd.Args[0], reason)
+	} else {
+		a.conn.SendRawf("PART %s", cmd.Args[0])
+	}
+	a.conn.Noticef(cmd.Nick, "Leaving %s.", cmd.Args[0])
+	return nil
+}
+
+func (a *adminCommands) reload(cmd *commandContext) error {
+	if err := a.settings.Load(); err != nil {
+		return fmt.Errorf("could not reload settings: %w", err)
+	}
+	if err := reloadTemplates(); err != nil {
+		return fmt.Errorf("could not reload templates: %w", err)
+	}
+	a.conn.Notice(cmd.Nick, "Reloaded settings and templates.")
+	return nil
+}
+
+func (a *adminCommands) stats(cmd *commandContext) error {
+	stats := a.manager.Stats()
+	parserNames := []string{}
+	for _, p := range a.manager.GetParsers() {
+		parserNames = append(parserNames, p.Name())
+	}
+	channelModeLock.RLock()
+	channelCount := len(channelModes)
+	channelModeLock.RUnlock()
+
+	a.conn.Noticef(cmd.Nick, "Up for %s, in %d channels. Links parsed: %d, errors: %d, unhandled: %d. Parsers: %s.",
+		time.Since(a.startTime).Round(time.Second),
+		channelCount,
+		stats.Parsed, stats.Errors, stats.Ignored,
+		strings.Join(parserNames, ", "))
+	return nil
+}
+
+func (a *adminCommands) clearCache(cmd *commandContext) error {
+	a.manager.ClearCache()
+	a.conn.Notice(cmd.Nick, "Cleared all caches.")
+	return nil
+}
+
+func (a *adminCommands) ignore(cmd *commandContext) error {
+	if len(cmd.Args) < 1 {
+		masks := a.settings.IgnoreMasks()
+		if len(masks) == 0 {
+			a.conn.Notice(cmd.Nick, "Nobody is being ignored.")
+		} else {
+			a.conn.Noticef(cmd.Nick, "Ignoring: %s", strings.Join(masks, ", "))
+		}
+		return nil
+	}
+
+	added, err := a.settings.AddIgnoreMask(cmd.Args[0])
+	if !added {
+		a.conn.Noticef(cmd.Nick, "%s is already being ignored.", cmd.Args[0])
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a.conn.Noticef(cmd.Nick, "Now ignoring %s in all channels.", cmd.Args[0])
+	return nil
+}
+
+func (a *adminCommands) unignore(cmd *commandContext) error {
+	if len(cmd.Args) < 1 {
+		return errUsage
+	}
+
+	removed, err := a.settings.RemoveIgnoreMask(cmd.Args[0])
+	if !removed {
+		a.conn.Noticef(cmd.Nick, "%s is not being ignored.", cmd.Args[0])
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a.conn.Noticef(cmd.Nick, "No longer ignoring %s.", cmd.Args[0])
+	return nil
+}
+
+func (a *adminCommands) restart(cmd *commandContext) error {
+	reason := cmd.ArgLine
+	if len(reason) == 0 {
+		reason = fmt.Sprintf("Restart requested by %s", cmd.Nick)
+	}
+	a.conn.Notice(cmd.Nick, "Restarting now.")
+	a.Restart(reason)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// defaultBridgePattern matches messages relayed as "<nick> text", which is
+// what most Matrix and Discord bridges send.
+const defaultBridgePattern = `^<(?P<nick>[^>]+)> (?P<text>.*)$`
+
+var errBridgePatternGroups = errors.New("bridge pattern needs to have the named groups \"nick\" and \"text\"")
+
+// bridgeNickInvisibleChars are removed from relayed nicknames. Bridges insert
+// them to keep IRC clients from highlighting users.
+var bridgeNickInvisibleChars = strings.NewReplacer(
+	"\u200b", "",
+	"\u200c", "",
+	"\u200d", "",
+	"\u2060", "",
+	"\ufeff", "",
+)
+
+// bridgeRelays recognizes messages that bridge bots relay on behalf of users
+// of other chat networks.
+type bridgeRelays struct {
+	masks     []string
+	pattern   *regexp.Regexp
+	nickGroup int
+	textGroup int
+}
+
+// newBridgeRelays sets up bridges matching the given masks, which use the
+// same format as ignore masks. The pattern must contain the named groups
+// "nick" and "text" to extract the actual sender and message.
+func newBridgeRelays(masks []string, pattern string) (*bridgeRelays, error) {
+	rx, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bridgeRelays{
+		masks:     masks,
+		pattern:   rx,
+		nickGroup: rx.SubexpIndex("nick"),
+		textGroup: rx.SubexpIndex("text"),
+	}
+	if b.nickGroup < 0 || b.textGroup < 0 {
+		return nil, errBridgePatternGroups
+	}
+	return b, nil
+}
+
+// Unwrap returns the actual sender and text of a message if it has been
+// relayed by a bridge. Other messages are returned unchanged.
+func (b *bridgeRelays) Unwrap(sender *messageSender, msg string) (*messageSender, string) {
+	if !matchIgnoreList(b.masks, sender) {
+		return sender, msg
+	}
+
+	matches := b.pattern.FindStringSubmatch(msg)
+	if matches == nil {
+		// Probably a message by the bridge itself
+		return sender, msg
+	}
+	nick := sanitizeBridgeNick(matches[b.nickGroup])
+	if len(nick) == 0 {
+		return sender, msg
+	}
+
+	relayedSender := &messageSender{
+		Nick:   nick,
+		Source: nick,
+		Bridge: sender.Nick,
+	}
+	if i := strings.IndexRune(sender.Source, '!'); i >= 0 {
+		// Keep the host of the bridge so it can be ignored as a whole
+		relayedSender.Source = nick + sender.Source[i:]
+	}
+	return relayedSender, matches[b.textGroup]
+}
+
+// sanitizeBridgeNick removes invisible characters from a relayed nickname as
+// well as spaces and the characters that have a meaning in hostmasks, which
+// would otherwise allow relayed users to match ignore masks of others.
+func sanitizeBridgeNick(nick string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || strings.ContainsRune("!@*?", r) {
+			return -1
+		}
+		return r
+	}, bridgeNickInvisibleChars.Replace(nick))
+}
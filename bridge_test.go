@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BridgeRelays(t *testing.T) {
+	b, err := newBridgeRelays([]string{"matrix*", "*!*@discord.example.com"}, defaultBridgePattern)
+	require.NoError(t, err)
+
+	bridge := &messageSender{
+		Nick:   "MatrixBridge",
+		Source: "MatrixBridge!bridge@matrix.example.com",
+		IsBot:  true,
+	}
+	sender, msg := b.Unwrap(bridge, "<al\u200bice> look at https://example.com")
+	assert.Equal(t, "look at https://example.com", msg)
+	assert.Equal(t, "alice", sender.Nick)
+	assert.Equal(t, "alice!bridge@matrix.example.com", sender.Source)
+	assert.Equal(t, "MatrixBridge", sender.Bridge)
+	assert.False(t, sender.IsBot)
+
+	sender, _ = b.Unwrap(&messageSender{
+		Nick:   "Relay",
+		Source: "Relay!relay@discord.example.com",
+	}, "<bob> hi")
+	assert.Equal(t, "bob", sender.Nick)
+
+	// Relayed nicknames can not pose as other hostmasks
+	sender, _ = b.Unwrap(bridge, "<eve!*@* ?> hi")
+	assert.Equal(t, "eve", sender.Nick)
+	assert.Equal(t, "eve!bridge@matrix.example.com", sender.Source)
+	sender, _ = b.Unwrap(bridge, "<!@*> hi")
+	assert.Same(t, bridge, sender)
+
+	// Messages by the bridge itself and users that are no bridges are left
+	// alone
+	sender, msg = b.Unwrap(bridge, "alice joined the room")
+	assert.Same(t, bridge, sender)
+	assert.Equal(t, "alice joined the room", msg)
+	user := &messageSender{Nick: "user", Source: "user!user@example.com"}
+	sender, msg = b.Unwrap(user, "<alice> hi")
+	assert.Same(t, user, sender)
+	assert.Equal(t, "<alice> hi", msg)
+}
+
+func Test_BridgeRelays_Pattern(t *testing.T) {
+	_, err := newBridgeRelays(nil, `^<([^>]+)> (.*)$`)
+	assert.ErrorIs(t, err, errBridgePatternGroups)
+	_, err = newBridgeRelays(nil, `(`)
+	assert.Error(t, err)
+
+	b, err := newBridgeRelays([]string{"discord"}, `^\[(?P<nick>[^\]]+)\] (?P<text>.*)$`)
+	require.NoError(t, err)
+	sender, msg := b.Unwrap(&messageSender{Nick: "Discord", Source: "Discord!d@example.com"}, "[carol] hello")
+	assert.Equal(t, "carol", sender.Nick)
+	assert.Equal(t, "hello", msg)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// capNegotiator requests IRCv3 capabilities after registration.
+//
+// go-ircevent has RequestCaps and AcknowledgedCaps, but it resets them on
+// every connect to request nothing but sasl, sends CAP LS without version 302
+// so we would not see capability values, and does not handle CAP NEW and
+// CAP DEL. So we do our own negotiation using CAP LS 302/REQ once we are
+// connected.
+type capNegotiator struct {
+	lock sync.RWMutex
+
+	wanted    []string
+	available map[string]string
+	enabled   map[string]bool
+	listing   bool
+}
+
+func newCapNegotiator(wanted ...string) *capNegotiator {
+	n := &capNegotiator{
+		wanted: wanted,
+	}
+	n.Reset()
+	return n
+}
+
+// Reset forgets all capabilities, to be called whenever we (re)connect.
+func (n *capNegotiator) Reset() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.available = map[string]string{}
+	n.enabled = map[string]bool{}
+	n.listing = false
+}
+
+// Enabled checks whether the server acknowledged the given capability.
+func (n *capNegotiator) Enabled(name string) bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.enabled[name]
+}
+
+func parseCapList(list string) map[string]string {
+	caps := map[string]string{}
+	for _, token := range strings.Fields(list) {
+		name, value := token, ""
+		if i := strings.IndexRune(token, '='); i >= 0 {
+			name, value = token[0:i], token[i+1:]
+		}
+		caps[name] = value
+	}
+	return caps
+}
+
+// Handle processes a CAP message from the server and returns the capability
+// requests to send to the server, if any.
+//
+// Arguments are expected as sent by the server: our nickname, the
+// subcommand, an optional "*" for continued lists and the capability list.
+func (n *capNegotiator) Handle(args []string) (requests []string) {
+	if len(args) < 3 {
+		return
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	subcommand := strings.ToUpper(args[1])
+	isContinued := len(args) > 3 && args[2] == "*"
+	caps := parseCapList(args[len(args)-1])
+
+	switch subcommand {
+	case "LS", "NEW":
+		if !n.listing {
+			n.listing = true
+			if subcommand == "LS" {
+				n.available = map[string]string{}
+			}
+		}
+		for name, value := range caps {
+			n.available[name] = value
+		}
+		if isContinued {
+			return
+		}
+		n.listing = false
+
+		for _, name := range n.wanted {
+			if _, ok := n.available[name]; ok && !n.enabled[name] {
+				requests = append(requests, name)
+			}
+		}
+	case "ACK":
+		for name := range caps {
+			if strings.HasPrefix(name, "-") {
+				delete(n.enabled, name[1:])
+			} else {
+				n.enabled[name] = true
+			}
+		}
+	case "DEL":
+		for name := range caps {
+			delete(n.available, name)
+			delete(n.enabled, name)
+		}
+	}
+
+	return
+}
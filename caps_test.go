@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CapNegotiator(t *testing.T) {
+	n := newCapNegotiator("message-tags", "multi-prefix", "userhost-in-names")
+
+	// Continued list must not trigger requests yet
+	assert.Empty(t, n.Handle([]string{"bot", "LS", "*", "sasl=PLAIN,EXTERNAL multi-prefix"}))
+	assert.Equal(t, []string{"message-tags", "multi-prefix"},
+		n.Handle([]string{"bot", "LS", "message-tags away-notify"}))
+	assert.False(t, n.Enabled("message-tags"))
+
+	assert.Empty(t, n.Handle([]string{"bot", "ACK", "message-tags multi-prefix"}))
+	assert.True(t, n.Enabled("message-tags"))
+	assert.True(t, n.Enabled("multi-prefix"))
+
+	// Newly offered capabilities get requested, enabled ones not again
+	assert.Equal(t, []string{"userhost-in-names"},
+		n.Handle([]string{"bot", "NEW", "userhost-in-names"}))
+
+	assert.Empty(t, n.Handle([]string{"bot", "DEL", "multi-prefix"}))
+	assert.False(t, n.Enabled("multi-prefix"))
+
+	n.Reset()
+	assert.False(t, n.Enabled("message-tags"))
+}
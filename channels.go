@@ -7,17 +7,36 @@ import (
 
 const (
 	colorBlock = "c"
+	modeKey    = 'k'
+
+	// maxJoinParamsLength keeps JOIN commands we send well below the IRC
+	// line length limit.
+	maxJoinParamsLength = 400
 )
 
 var (
-	channelModes    = map[string]string{}
-	channelModeLock sync.RWMutex
+	channelModes      = map[string]string{}
+	channelModeParams = map[string]map[rune]string{}
+	channelModeLock   sync.RWMutex
 )
 
 func setChannelMode(channel string, mode rune) {
+	setChannelModeParam(channel, mode, "")
+}
+
+func setChannelModeParam(channel string, mode rune, param string) {
 	channelModeLock.Lock()
 	defer channelModeLock.Unlock()
-	channel = strings.ToLower(channel)
+	channel = foldName(channel)
+
+	if len(param) > 0 {
+		params, ok := channelModeParams[channel]
+		if !ok {
+			params = map[rune]string{}
+			channelModeParams[channel] = params
+		}
+		params[mode] = param
+	}
 
 	modes, ok := channelModes[channel]
 	if !ok {
@@ -35,15 +54,26 @@ func setChannelMode(channel string, mode rune) {
 func resetChannelModes(channel string) {
 	channelModeLock.Lock()
 	defer channelModeLock.Unlock()
-	channel = strings.ToLower(channel)
+	channel = foldName(channel)
 
 	channelModes[channel] = ""
+	delete(channelModeParams, channel)
+}
+
+// resetAllChannelModes forgets the modes of all channels, for example when
+// we got disconnected.
+func resetAllChannelModes() {
+	channelModeLock.Lock()
+	defer channelModeLock.Unlock()
+
+	channelModes = map[string]string{}
+	channelModeParams = map[string]map[rune]string{}
 }
 
 func unsetChannelMode(channel string, mode rune) {
 	channelModeLock.Lock()
 	defer channelModeLock.Unlock()
-	channel = strings.ToLower(channel)
+	channel = foldName(channel)
 
 	modes := channelModes[channel]
 	index := strings.IndexRune(modes, mode)
@@ -51,12 +81,15 @@ func unsetChannelMode(channel string, mode rune) {
 		modes = modes[0:index] + modes[index+1:]
 	}
 	channelModes[channel] = modes
+	if params, ok := channelModeParams[channel]; ok {
+		delete(params, mode)
+	}
 }
 
 func getChannelModes(channel string) string {
 	channelModeLock.RLock()
 	defer channelModeLock.RUnlock()
-	channel = strings.ToLower(channel)
+	channel = foldName(channel)
 	retval, ok := channelModes[channel]
 	if !ok {
 		return ""
@@ -64,6 +97,16 @@ func getChannelModes(channel string) string {
 	return retval
 }
 
+func getChannelModeParam(channel string, mode rune) (param string, ok bool) {
+	channelModeLock.RLock()
+	defer channelModeLock.RUnlock()
+	channel = foldName(channel)
+	if params, exists := channelModeParams[channel]; exists {
+		param, ok = params[mode]
+	}
+	return
+}
+
 func hasChannelMode(channel string, mode rune) bool {
 	modes := getChannelModes(channel)
 	return strings.ContainsRune(modes, mode)
@@ -72,13 +115,133 @@ func hasChannelMode(channel string, mode rune) bool {
 func deleteChannelModes(channel string) {
 	channelModeLock.Lock()
 	defer channelModeLock.Unlock()
-	channel = strings.ToLower(channel)
+	channel = foldName(channel)
 	delete(channelModes, channel)
+	delete(channelModeParams, channel)
+}
+
+// channelModeChange describes a single mode being set or unset on a channel.
+type channelModeChange struct {
+	Add   bool
+	Mode  rune
+	Type  channelModeType
+	Param string
+}
+
+// parseChannelModeChanges splits up a mode string and its parameters into
+// single mode changes, consuming parameters as advertised by the server via
+// CHANMODES and PREFIX.
+func parseChannelModeChanges(modes string, params []string) (changes []channelModeChange) {
+	add := true
+	for _, mode := range modes {
+		switch mode {
+		case '+':
+			add = true
+		case '-':
+			add = false
+		default:
+			change := channelModeChange{
+				Add:  add,
+				Mode: mode,
+				Type: serverSupport.ChannelModeType(mode),
+			}
+			if serverSupport.ModeTakesParam(mode, add) && len(params) > 0 {
+				change.Param = params[0]
+				params = params[1:]
+			}
+			changes = append(changes, change)
+		}
+	}
+	return
+}
+
+// applyChannelModeChanges updates our knowledge of a channel's modes.
+//
+// List and prefix modes are not stored as channel modes since they do not
+// describe the channel itself.
+func applyChannelModeChanges(channel string, changes []channelModeChange) {
+	for _, change := range changes {
+		switch change.Type {
+		case channelModeTypeList, channelModeTypePrefix:
+			continue
+		}
+
+		if change.Add {
+			setChannelModeParam(channel, change.Mode, change.Param)
+		} else {
+			unsetChannelMode(channel, change.Mode)
+		}
+	}
 }
 
 func stripIrcFormattingIfChannelBlocksColors(channel string, text string) string {
-	if strings.Contains(getChannelModes(channel), "c") {
+	if strings.Contains(getChannelModes(channel), colorBlock) {
 		text = stripIrcFormatting(text)
 	}
 	return text
 }
+
+// formatChannelOutput strips formatting from text sent to a channel if
+// either the channel blocks colors or the channel settings ask us to.
+func formatChannelOutput(channel string, cs *channelSettings, text string) string {
+	if cs.StripFormatting {
+		return stripIrcFormatting(text)
+	}
+	return stripIrcFormattingIfChannelBlocksColors(channel, text)
+}
+
+// sendChannelOutput sends text formatted by formatChannelOutput to a channel.
+// The text is sent as a notice if asNotice is set or the channel settings ask
+// for notices, otherwise as a normal message.
+func sendChannelOutput(conn ircReplier, channel string, cs *channelSettings, asNotice bool, text string) {
+	text = formatChannelOutput(channel, cs, text)
+	if asNotice || cs.UseNotice {
+		conn.Notice(channel, text)
+	} else {
+		conn.Privmsg(channel, text)
+	}
+}
+
+// joinParams builds the parameters for as few JOIN commands as possible to
+// join the given channels. Keyed channels are put first since keys are
+// assigned to channels in order.
+func joinParams(channels []joinedChannel) (result []string) {
+	keyed := []joinedChannel{}
+	unkeyed := []joinedChannel{}
+	for _, channel := range channels {
+		if len(channel.Key) > 0 {
+			keyed = append(keyed, channel)
+		} else {
+			unkeyed = append(unkeyed, channel)
+		}
+	}
+
+	names, keys := []string{}, []string{}
+	length := 0
+	flush := func() {
+		if len(names) == 0 {
+			return
+		}
+		params := strings.Join(names, ",")
+		if len(keys) > 0 {
+			params += " " + strings.Join(keys, ",")
+		}
+		result = append(result, params)
+		names, keys = []string{}, []string{}
+		length = 0
+	}
+	for _, channel := range append(keyed, unkeyed...) {
+		added := len(channel.Name) + len(channel.Key) + 2
+		if length+added > maxJoinParamsLength {
+			flush()
+		}
+		names = append(names, channel.Name)
+		if len(channel.Key) > 0 {
+			keys = append(keys, channel.Key)
+		}
+		length += added
+	}
+	flush()
+
+	return
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JoinParams(t *testing.T) {
+	assert.Empty(t, joinParams(nil))
+
+	assert.Equal(t, []string{"#keyed,#other,#a,#b key1,key2"}, joinParams([]joinedChannel{
+		{Name: "#a"},
+		{Name: "#keyed", Key: "key1"},
+		{Name: "#b"},
+		{Name: "#other", Key: "key2"},
+	}))
+
+	channels := []joinedChannel{}
+	for i := 0; i < 100; i++ {
+		channels = append(channels, joinedChannel{Name: fmt.Sprintf("#channel%02d", i)})
+	}
+	params := joinParams(channels)
+	assert.Greater(t, len(params), 1)
+	joined := []string{}
+	for _, p := range params {
+		assert.LessOrEqual(t, len(p), maxJoinParamsLength)
+		joined = append(joined, strings.Split(p, ",")...)
+	}
+	assert.Len(t, joined, 100)
+}
+
+func Test_ResetAllChannelModes(t *testing.T) {
+	defer resetAllChannelModes()
+
+	setChannelModeParam("#a", 'l', "50")
+	setChannelMode("#b", 'c')
+	resetAllChannelModes()
+
+	assert.Empty(t, getChannelModes("#a"))
+	assert.False(t, hasChannelMode("#b", 'c'))
+	_, ok := getChannelModeParam("#a", 'l')
+	assert.False(t, ok)
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/icedream/irc-medialink/manager"
+)
+
+// ircReplier describes the methods of the IRC connection that commands use
+// to reply to users.
+type ircReplier interface {
+	Privmsg(target, message string)
+	Privmsgf(target, format string, a ...interface{})
+	Notice(target, message string)
+	Noticef(target, format string, a ...interface{})
+}
+
+// commandContext describes a single invocation of a command.
+type commandContext struct {
+	// Nick is the nickname of the user who sent the command.
+	Nick string
+	// Source is the nick!user@host mask of the user who sent the command.
+	Source string
+	// Sender describes the user who sent the command, including what the
+	// server told us about them via message tags.
+	Sender *messageSender
+	// Target is the channel the command was sent to, or the nickname of the
+	// user if the command has been sent in private.
+	Target string
+	// IsChannel is set if the command was sent to a channel.
+	IsChannel bool
+
+	// Prefix is the command prefix the command was sent with.
+	Prefix string
+	// Name is the name of the command without the prefix.
+	Name string
+	// Args contains the whitespace-separated arguments of the command.
+	Args []string
+	// ArgLine contains the arguments as typed by the user.
+	ArgLine string
+}
+
+type commandHandlerFunc func(cmd *commandContext)
+
+// errUsage is returned by command implementations if the command has been
+// used incorrectly.
+var errUsage = errors.New("invalid usage")
+
+// commandRegistry dispatches prefixed commands such as "!medialink status" to
+// their handlers.
+type commandRegistry struct {
+	lock     sync.RWMutex
+	prefix   string
+	handlers map[string]commandHandlerFunc
+
+	// RedactLog removes sensitive information from command arguments before
+	// they are logged, if set.
+	RedactLog func(text string) string
+}
+
+func newCommandRegistry(prefix string) *commandRegistry {
+	return &commandRegistry{
+		prefix:   prefix,
+		handlers: map[string]commandHandlerFunc{},
+	}
+}
+
+// Register adds a command handler. Command names are case-insensitive.
+func (r *commandRegistry) Register(name string, handler commandHandlerFunc) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.handlers[strings.ToLower(name)] = handler
+}
+
+// parse splits up a message into a command invocation if it starts with the
+// command prefix. With an empty prefix, every message is a command.
+func (r *commandRegistry) parse(msg string) (cmd *commandContext, ok bool) {
+	if !strings.HasPrefix(msg, r.prefix) {
+		return
+	}
+
+	line := strings.TrimSpace(msg[len(r.prefix):])
+	name := line
+	argLine := ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, argLine = line[0:i], strings.TrimSpace(line[i+1:])
+	}
+	if len(name) == 0 {
+		return
+	}
+
+	cmd = &commandContext{
+		Prefix:  r.prefix,
+		Name:    strings.ToLower(name),
+		Args:    strings.Fields(argLine),
+		ArgLine: argLine,
+	}
+	ok = true
+	return
+}
+
+// IsCommand checks whether the message is a registered command.
+func (r *commandRegistry) IsCommand(msg string) bool {
+	cmd, ok := r.parse(msg)
+	if !ok {
+		return false
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok = r.handlers[cmd.Name]
+	return ok
+}
+
+// Handle runs the command contained in the given message, if any, and
+// returns whether the message was a known command.
+func (r *commandRegistry) Handle(sender *messageSender, target string, isChannel bool, msg string) bool {
+	cmd, ok := r.parse(msg)
+	if !ok {
+		return false
+	}
+
+	r.lock.RLock()
+	handler, ok := r.handlers[cmd.Name]
+	r.lock.RUnlock()
+	if !ok {
+		return false
+	}
+
+	cmd.Nick = sender.Nick
+	cmd.Source = sender.Source
+	cmd.Sender = sender
+	cmd.Target = target
+	cmd.IsChannel = isChannel
+	argLine := cmd.ArgLine
+	if r.RedactLog != nil {
+		argLine = r.RedactLog(argLine)
+	}
+	log.Printf("Command from %s in %s: %s %s", sender.Nick, target, cmd.Name, argLine)
+	handler(cmd)
+	return true
+}
+
+// parseSwitch interprets common ways to say on or off.
+func parseSwitch(value string) (on bool, ok bool) {
+	switch strings.ToLower(value) {
+	case "on", "yes", "true", "1", "enable", "enabled":
+		return true, true
+	case "off", "no", "false", "0", "disable", "disabled":
+		return false, true
+	}
+	return
+}
+
+func formatSwitch(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// channelOption describes an output option channel operators can change via
+// the set subcommand.
+type channelOption struct {
+	Description string
+	Get         func(cs *channelSettings) bool
+	Set         func(cs *channelSettings, on bool)
+}
+
+var channelOptions = map[string]channelOption{
+	"colors": {
+		Description: "use colors and formatting",
+		Get:         func(cs *channelSettings) bool { return !cs.StripFormatting },
+		Set:         func(cs *channelSettings, on bool) { cs.StripFormatting = !on },
+	},
+	"errors": {
+		Description: "report links that could not be parsed",
+		Get:         func(cs *channelSettings) bool { return !cs.HideErrors },
+		Set:         func(cs *channelSettings, on bool) { cs.HideErrors = !on },
+	},
+	"notice": {
+		Description: "send link information as notices",
+		Get:         func(cs *channelSettings) bool { return cs.UseNotice },
+		Set:         func(cs *channelSettings, on bool) { cs.UseNotice = on },
+	},
+	"bots": {
+		Description: "handle links posted by other bots",
+		Get:         func(cs *channelSettings) bool { return cs.AllowBots },
+		Set:         func(cs *channelSettings, on bool) { cs.AllowBots = on },
+	},
+}
+
+func channelOptionNames() []string {
+	names := make([]string, 0, len(channelOptions))
+	for name := range channelOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newMediaLinkCommand creates the handler for the command that allows channel
+// operators to control the bot in their channel.
+func newMediaLinkCommand(conn ircReplier, m *manager.Manager, settings *settingsStore) commandHandlerFunc {
+	updateSettings := func(cmd *commandContext, update func(cs *channelSettings)) bool {
+		if err := settings.UpdateChannel(cmd.Target, update); err != nil {
+			log.Printf("WARNING: Could not save settings for %s: %s", cmd.Target, err.Error())
+			conn.Notice(cmd.Nick, "Your change has been applied but could not be saved, it will be lost when I restart.")
+			return false
+		}
+		return true
+	}
+
+	requireOperator := func(cmd *commandContext) bool {
+		if isChannelOperator(cmd.Target, cmd.Nick) {
+			return true
+		}
+		conn.Noticef(cmd.Nick, "You need to be a channel operator in %s to do this.", cmd.Target)
+		return false
+	}
+
+	return func(cmd *commandContext) {
+		if !cmd.IsChannel {
+			conn.Notice(cmd.Nick, "This command can only be used in a channel.")
+			return
+		}
+
+		subcommand := "status"
+		if len(cmd.Args) > 0 {
+			subcommand = strings.ToLower(cmd.Args[0])
+		}
+
+		switch subcommand {
+		case "status":
+			cs := settings.Channel(cmd.Target)
+			status := "enabled"
+			if cs.Disabled {
+				status = "paused"
+			}
+			options := []string{}
+			for _, name := range channelOptionNames() {
+				options = append(options, fmt.Sprintf("%s: %s", name, formatSwitch(channelOptions[name].Get(&cs))))
+			}
+			disabledParsers := "none"
+			if len(cs.DisabledParsers) > 0 {
+				disabledParsers = strings.Join(cs.DisabledParsers, ", ")
+			}
+			conn.Noticef(cmd.Nick, "Link parsing in %s is %s. Disabled parsers: %s. Options: %s.",
+				cmd.Target, status, disabledParsers, strings.Join(options, ", "))
+
+		case "on", "off":
+			if !requireOperator(cmd) {
+				return
+			}
+			disabled := subcommand == "off"
+			if updateSettings(cmd, func(cs *channelSettings) { cs.Disabled = disabled }) {
+				if disabled {
+					conn.Privmsgf(cmd.Target, "Link parsing in %s is now paused.", cmd.Target)
+				} else {
+					conn.Privmsgf(cmd.Target, "Link parsing in %s is now enabled.", cmd.Target)
+				}
+			}
+
+		case "parsers":
+			cs := settings.Channel(cmd.Target)
+			if len(cmd.Args) < 2 {
+				parserStates := []string{}
+				for _, p := range m.GetParsers() {
+					parserStates = append(parserStates, fmt.Sprintf("%s (%s)", p.Name(), formatSwitch(cs.IsParserEnabled(p.Name()))))
+				}
+				conn.Noticef(cmd.Nick, "Loaded parsers: %s.", strings.Join(parserStates, ", "))
+				return
+			}
+
+			if len(cmd.Args) < 3 {
+				conn.Noticef(cmd.Nick, "Usage: %s%s parsers [<parser> on|off]", cmd.Prefix, cmd.Name)
+				return
+			}
+			if !requireOperator(cmd) {
+				return
+			}
+			var parserName string
+			for _, p := range m.GetParsers() {
+				if strings.EqualFold(p.Name(), cmd.Args[1]) {
+					parserName = p.Name()
+					break
+				}
+			}
+			if len(parserName) == 0 {
+				conn.Noticef(cmd.Nick, "There is no parser called %s.", cmd.Args[1])
+				return
+			}
+			on, ok := parseSwitch(cmd.Args[2])
+			if !ok {
+				conn.Noticef(cmd.Nick, "Usage: %s%s parsers [<parser> on|off]", cmd.Prefix, cmd.Name)
+				return
+			}
+			if updateSettings(cmd, func(cs *channelSettings) { cs.SetParserEnabled(parserName, on) }) {
+				conn.Privmsgf(cmd.Target, "The %s parser is now %s in %s.", parserName, formatSwitch(on), cmd.Target)
+			}
+
+		case "shorthands":
+			cs := settings.Channel(cmd.Target)
+			if len(cmd.Args) < 2 {
+				shorthandStates := []string{}
+				for _, name := range shorthandNames() {
+					shorthandStates = append(shorthandStates, fmt.Sprintf("%s like %s (%s)", name, shorthands[name].Example, formatSwitch(cs.IsShorthandEnabled(name))))
+				}
+				conn.Noticef(cmd.Nick, "Recognized shorthands: %s.", strings.Join(shorthandStates, ", "))
+				return
+			}
+
+			if len(cmd.Args) < 3 {
+				conn.Noticef(cmd.Nick, "Usage: %s%s shorthands [<shorthand> on|off]", cmd.Prefix, cmd.Name)
+				return
+			}
+			if !requireOperator(cmd) {
+				return
+			}
+			name := strings.ToLower(cmd.Args[1])
+			if _, ok := shorthands[name]; !ok {
+				conn.Noticef(cmd.Nick, "There is no shorthand called %s, available shorthands: %s",
+					cmd.Args[1], strings.Join(shorthandNames(), ", "))
+				return
+			}
+			on, ok := parseSwitch(cmd.Args[2])
+			if !ok {
+				conn.Noticef(cmd.Nick, "Usage: %s%s shorthands [<shorthand> on|off]", cmd.Prefix, cmd.Name)
+				return
+			}
+			if updateSettings(cmd, func(cs *channelSettings) { cs.SetShorthandEnabled(name, on) }) {
+				conn.Privmsgf(cmd.Target, "%s shorthands are now %s in %s.", name, formatSwitch(on), cmd.Target)
+			}
+
+		case "set":
+			if len(cmd.Args) < 3 {
+				conn.Noticef(cmd.Nick, "Usage: %s%s set <option> <value> - available options: %s",
+					cmd.Prefix, cmd.Name, strings.Join(channelOptionNames(), ", "))
+				return
+			}
+			option, ok := channelOptions[strings.ToLower(cmd.Args[1])]
+			if !ok {
+				conn.Noticef(cmd.Nick, "Unknown option %s, available options: %s",
+					cmd.Args[1], strings.Join(channelOptionNames(), ", "))
+				return
+			}
+			on, ok := parseSwitch(cmd.Args[2])
+			if !ok {
+				conn.Noticef(cmd.Nick, "The value for %s must be on or off.", strings.ToLower(cmd.Args[1]))
+				return
+			}
+			if !requireOperator(cmd) {
+				return
+			}
+			if updateSettings(cmd, func(cs *channelSettings) { option.Set(cs, on) }) {
+				if on {
+					conn.Privmsgf(cmd.Target, "I will now %s in %s.", option.Description, cmd.Target)
+				} else {
+					conn.Privmsgf(cmd.Target, "I will no longer %s in %s.", option.Description, cmd.Target)
+				}
+			}
+
+		case "domains":
+			if len(cmd.Args) < 2 {
+				cs := settings.Channel(cmd.Target)
+				allowed, denied := "all", "none"
+				if len(cs.AllowedDomains) > 0 {
+					allowed = strings.Join(cs.AllowedDomains, ", ")
+				}
+				if len(cs.DeniedDomains) > 0 {
+					denied = strings.Join(cs.DeniedDomains, ", ")
+				}
+				conn.Noticef(cmd.Nick, "Allowed domains in %s: %s. Denied domains: %s.", cmd.Target, allowed, denied)
+				return
+			}
+
+			action := strings.ToLower(cmd.Args[1])
+			if len(cmd.Args) < 3 || (action != "allow" && action != "deny" && action != "remove") {
+				conn.Noticef(cmd.Nick, "Usage: %s%s domains [allow|deny|remove <domain>] - use *.example.com to include subdomains", cmd.Prefix, cmd.Name)
+				return
+			}
+			pattern := cmd.Args[2]
+			if !isValidDomainPattern(pattern) {
+				conn.Noticef(cmd.Nick, "%s is not a valid domain.", pattern)
+				return
+			}
+			if !requireOperator(cmd) {
+				return
+			}
+			pattern = normalizeDomain(pattern)
+			changed := false
+			if !updateSettings(cmd, func(cs *channelSettings) {
+				var removedAllowed, removedDenied bool
+				cs.AllowedDomains, removedAllowed = removeDomainPattern(cs.AllowedDomains, pattern)
+				cs.DeniedDomains, removedDenied = removeDomainPattern(cs.DeniedDomains, pattern)
+				switch action {
+				case "allow":
+					cs.AllowedDomains, changed = addDomainPattern(cs.AllowedDomains, pattern)
+				case "deny":
+					cs.DeniedDomains, changed = addDomainPattern(cs.DeniedDomains, pattern)
+				case "remove":
+					changed = removedAllowed || removedDenied
+				}
+			}) {
+				return
+			}
+			switch {
+			case action == "remove" && !changed:
+				conn.Noticef(cmd.Nick, "%s is not on any domain list in %s.", pattern, cmd.Target)
+			case action == "remove":
+				conn.Privmsgf(cmd.Target, "Removed %s from the domain lists in %s.", pattern, cmd.Target)
+			case action == "allow":
+				conn.Privmsgf(cmd.Target, "Links to %s are now allowed in %s.", pattern, cmd.Target)
+			default:
+				conn.Privmsgf(cmd.Target, "Links to %s will no longer be fetched in %s.", pattern, cmd.Target)
+			}
+
+		case "ignore":
+			if len(cmd.Args) < 2 {
+				cs := settings.Channel(cmd.Target)
+				if len(cs.Ignore) == 0 {
+					conn.Noticef(cmd.Nick, "Nobody is being ignored in %s.", cmd.Target)
+				} else {
+					conn.Noticef(cmd.Nick, "Ignoring in %s: %s", cmd.Target, strings.Join(cs.Ignore, ", "))
+				}
+				return
+			}
+			if !requireOperator(cmd) {
+				return
+			}
+			mask := cmd.Args[1]
+			added := false
+			if !updateSettings(cmd, func(cs *channelSettings) { cs.Ignore, added = addIgnoreMask(cs.Ignore, mask) }) {
+				return
+			}
+			if added {
+				conn.Privmsgf(cmd.Target, "Now ignoring %s in %s.", mask, cmd.Target)
+			} else {
+				conn.Noticef(cmd.Nick, "%s is already being ignored in %s.", mask, cmd.Target)
+			}
+
+		case "unignore":
+			if len(cmd.Args) < 2 {
+				conn.Noticef(cmd.Nick, "Usage: %s%s unignore <mask>", cmd.Prefix, cmd.Name)
+				return
+			}
+			if !requireOperator(cmd) {
+				return
+			}
+			mask := cmd.Args[1]
+			removed := false
+			if !updateSettings(cmd, func(cs *channelSettings) { cs.Ignore, removed = removeIgnoreMask(cs.Ignore, mask) }) {
+				return
+			}
+			if removed {
+				conn.Privmsgf(cmd.Target, "No longer ignoring %s in %s.", mask, cmd.Target)
+			} else {
+				conn.Noticef(cmd.Nick, "%s is not being ignored in %s.", mask, cmd.Target)
+			}
+
+		default:
+			conn.Noticef(cmd.Nick, "Usage: %s%s on|off|status|parsers|shorthands|domains|ignore|unignore|set <option> <value>", cmd.Prefix, cmd.Name)
+		}
+	}
+}
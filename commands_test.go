@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/icedream/irc-medialink/manager"
+)
+
+// recordingReplier records the messages sent by commands by their target.
+type recordingReplier struct {
+	privmsgs map[string][]string
+	notices  map[string][]string
+}
+
+func newRecordingReplier() *recordingReplier {
+	return &recordingReplier{
+		privmsgs: map[string][]string{},
+		notices:  map[string][]string{},
+	}
+}
+
+func (r *recordingReplier) Privmsg(target, message string) {
+	r.privmsgs[target] = append(r.privmsgs[target], message)
+}
+
+func (r *recordingReplier) Privmsgf(target, format string, a ...interface{}) {
+	r.Privmsg(target, fmt.Sprintf(format, a...))
+}
+
+func (r *recordingReplier) Notice(target, message string) {
+	r.notices[target] = append(r.notices[target], message)
+}
+
+func (r *recordingReplier) Noticef(target, format string, a ...interface{}) {
+	r.Notice(target, fmt.Sprintf(format, a...))
+}
+
+func Test_CommandRegistry_Handle(t *testing.T) {
+	r := newCommandRegistry("!")
+
+	var received *commandContext
+	r.Register("MediaLink", func(cmd *commandContext) {
+		received = cmd
+	})
+
+	sender := &messageSender{Nick: "nick", Source: "nick!user@host"}
+	assert.False(t, r.Handle(sender, "#test", true, "medialink status"))
+	assert.False(t, r.Handle(sender, "#test", true, "!unknown"))
+	assert.False(t, r.Handle(sender, "#test", true, "!"))
+	assert.Nil(t, received)
+	assert.False(t, r.IsCommand("!unknown"))
+	assert.True(t, r.IsCommand("!MediaLink status"))
+	assert.Nil(t, received)
+
+	require.True(t, r.Handle(sender, "#test", true, "!MEDIALINK  set colors   off "))
+	require.NotNil(t, received)
+	assert.Equal(t, "!", received.Prefix)
+	assert.Equal(t, "medialink", received.Name)
+	assert.Equal(t, []string{"set", "colors", "off"}, received.Args)
+	assert.Equal(t, "set colors   off", received.ArgLine)
+	assert.Equal(t, "nick", received.Nick)
+	assert.Same(t, sender, received.Sender)
+	assert.Equal(t, "#test", received.Target)
+	assert.True(t, received.IsChannel)
+}
+
+func Test_MediaLinkCommand_Listings(t *testing.T) {
+	settings := newSettingsStore(filepath.Join(t.TempDir(), "settings.yml"))
+	require.NoError(t, settings.Load())
+
+	// Listings are only sent to the user asking for them
+	for _, args := range [][]string{{"status"}, {"parsers"}, {"shorthands"}, {"domains"}, {"ignore"}} {
+		conn := newRecordingReplier()
+		handler := newMediaLinkCommand(conn, manager.NewManager(), settings)
+		handler(&commandContext{Nick: "nick", Target: "#test", IsChannel: true, Prefix: "!", Name: "medialink", Args: args})
+		assert.Empty(t, conn.privmsgs, args)
+		assert.Len(t, conn.notices["nick"], 1, args)
+	}
+}
+
+func Test_ParseSwitch(t *testing.T) {
+	for _, value := range []string{"on", "ON", "yes", "true", "1"} {
+		on, ok := parseSwitch(value)
+		assert.True(t, ok, value)
+		assert.True(t, on, value)
+	}
+	for _, value := range []string{"off", "No", "false", "0"} {
+		on, ok := parseSwitch(value)
+		assert.True(t, ok, value)
+		assert.False(t, on, value)
+	}
+	_, ok := parseSwitch("maybe")
+	assert.False(t, ok)
+}
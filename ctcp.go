@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/icedream/irc-medialink/version"
+)
+
+// ctcpEvents lists the events go-ircevent fires for CTCP requests. We handle
+// all of them ourselves so that every reply goes through the same rate limit.
+var ctcpEvents = []string{
+	"CTCP",
+	"CTCP_CLIENTINFO",
+	"CTCP_PING",
+	"CTCP_TIME",
+	"CTCP_USERINFO",
+	"CTCP_VERSION",
+}
+
+type ctcpConn interface {
+	Notice(target, message string)
+}
+
+// ctcpHandler generates the reply to a CTCP request. Returning nil sends no
+// reply at all.
+type ctcpHandler func(request *ctcpMessage) (reply *ctcpMessage)
+
+// ctcpDispatcher answers CTCP requests sent to the bot.
+type ctcpDispatcher struct {
+	conn     ctcpConn
+	handlers map[string]ctcpHandler
+
+	// ShouldIgnore is called with the source of every request we would reply
+	// to and returns true if the request should be dropped instead.
+	ShouldIgnore func(source string) bool
+
+	// now returns the current time, used for TIME replies.
+	now func() time.Time
+}
+
+func newCTCPDispatcher(conn ctcpConn, versionString string) *ctcpDispatcher {
+	d := &ctcpDispatcher{
+		conn:     conn,
+		handlers: map[string]ctcpHandler{},
+		now:      time.Now,
+	}
+
+	d.Register("PING", func(request *ctcpMessage) *ctcpMessage {
+		return &ctcpMessage{Command: "PING", Params: request.Params}
+	})
+	d.Register("TIME", func(request *ctcpMessage) *ctcpMessage {
+		return &ctcpMessage{Command: "TIME", Params: []string{d.now().Format(time.RFC1123Z)}}
+	})
+	d.Register("VERSION", func(request *ctcpMessage) *ctcpMessage {
+		return &ctcpMessage{Command: "VERSION", Params: []string{versionString}}
+	})
+	d.Register("SOURCE", func(request *ctcpMessage) *ctcpMessage {
+		return &ctcpMessage{Command: "SOURCE", Params: []string{version.AppSourceURL}}
+	})
+	d.Register("CLIENTINFO", func(request *ctcpMessage) *ctcpMessage {
+		return &ctcpMessage{Command: "CLIENTINFO", Params: d.Commands()}
+	})
+	userInfo := func(request *ctcpMessage) *ctcpMessage {
+		return &ctcpMessage{
+			Command: request.Command,
+			Params:  []string{"IRC bot running", version.MakeHumanReadableVersionString(true, true)},
+		}
+	}
+	d.Register("USERINFO", userInfo)
+	d.Register("FINGER", userInfo)
+
+	return d
+}
+
+// Register sets the handler for the given CTCP command.
+func (d *ctcpDispatcher) Register(command string, handler ctcpHandler) {
+	d.handlers[strings.ToUpper(command)] = handler
+}
+
+// Commands returns the sorted list of CTCP commands we understand. ACTION is
+// handled separately as it is just a message.
+func (d *ctcpDispatcher) Commands() []string {
+	commands := []string{"ACTION"}
+	for command := range d.handlers {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// Handle answers the CTCP request sent by the given user. The message is the
+// request without its delimiters as passed on by go-ircevent.
+func (d *ctcpDispatcher) Handle(nick, source, message string) {
+	request, ok := parseCTCP(string(runeCTCPDelimiter) + message + string(runeCTCPDelimiter))
+	if !ok {
+		return
+	}
+	request.Command = strings.ToUpper(request.Command)
+
+	handler, ok := d.handlers[request.Command]
+	if !ok {
+		// Unknown requests are silently dropped, replying with an error
+		// would just make us another target for reflection
+		return
+	}
+
+	if d.ShouldIgnore != nil && d.ShouldIgnore(source) {
+		log.Printf("Not replying to CTCP %s from %s due to rate limit", request.Command, source)
+		return
+	}
+
+	if reply := handler(request); reply != nil {
+		d.conn.Notice(nick, reply.String())
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/icedream/irc-medialink/version"
+)
+
+type recordingCTCPConn struct {
+	notices []string
+}
+
+func (c *recordingCTCPConn) Notice(target, message string) {
+	c.notices = append(c.notices, target+" "+message)
+}
+
+func Test_CTCPDispatcher(t *testing.T) {
+	conn := new(recordingCTCPConn)
+	d := newCTCPDispatcher(conn, "MediaLink 1.0")
+	d.now = func() time.Time {
+		return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+
+	d.Handle("User", "User!user@example.com", "PING 1234")
+	d.Handle("User", "User!user@example.com", "time")
+	d.Handle("User", "User!user@example.com", "VERSION")
+	d.Handle("User", "User!user@example.com", "SOURCE")
+	d.Handle("User", "User!user@example.com", "CLIENTINFO")
+	d.Handle("User", "User!user@example.com", "UNKNOWN")
+
+	assert.Equal(t, []string{
+		"User \x01PING 1234\x01",
+		"User \x01TIME Thu, 02 Jan 2020 03:04:05 +0000\x01",
+		"User \x01VERSION MediaLink 1.0\x01",
+		"User \x01SOURCE " + version.AppSourceURL + "\x01",
+		"User \x01CLIENTINFO ACTION CLIENTINFO FINGER PING SOURCE TIME USERINFO VERSION\x01",
+	}, conn.notices)
+}
+
+func Test_CTCPDispatcher_ShouldIgnore(t *testing.T) {
+	conn := new(recordingCTCPConn)
+	d := newCTCPDispatcher(conn, "MediaLink 1.0")
+	requests := 0
+	d.ShouldIgnore = func(source string) bool {
+		requests++
+		return requests > 1
+	}
+
+	d.Handle("User", "User!user@example.com", "PING 1")
+	d.Handle("User", "User!user@example.com", "PING 2")
+	d.Handle("User", "User!user@example.com", "UNKNOWN")
+
+	assert.Equal(t, []string{"User \x01PING 1\x01"}, conn.notices)
+	assert.Equal(t, 2, requests, "unknown requests should not count")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/icedream/irc-medialink/util/domains"
+)
+
+// domainWildcardPrefix marks domain patterns that also match all subdomains.
+const domainWildcardPrefix = "*."
+
+// normalizeDomain brings a domain name or pattern into the form we compare
+// with, that is lowercase punycode without a trailing dot.
+func normalizeDomain(domain string) string {
+	return domains.Normalize(domain)
+}
+
+// matchDomain checks whether the given host name matches a domain pattern.
+//
+// A pattern like "example.com" only matches that exact domain while
+// "*.example.com" matches example.com itself and all of its subdomains.
+func matchDomain(pattern, host string) bool {
+	pattern = normalizeDomain(pattern)
+	if strings.HasPrefix(pattern, domainWildcardPrefix) {
+		return domains.IsSubdomain(pattern[len(domainWildcardPrefix):], host)
+	}
+	return normalizeDomain(host) == pattern
+}
+
+// matchDomainList checks whether any of the given domain patterns matches the
+// host name.
+func matchDomainList(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if matchDomain(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// addDomainPattern adds a domain pattern to a list unless it is already on it.
+func addDomainPattern(patterns []string, pattern string) ([]string, bool) {
+	pattern = normalizeDomain(pattern)
+	for _, existingPattern := range patterns {
+		if existingPattern == pattern {
+			return patterns, false
+		}
+	}
+	return append(patterns, pattern), true
+}
+
+// removeDomainPattern removes a domain pattern from a list.
+func removeDomainPattern(patterns []string, pattern string) ([]string, bool) {
+	pattern = normalizeDomain(pattern)
+	for i, existingPattern := range patterns {
+		if existingPattern == pattern {
+			result := append([]string{}, patterns[0:i]...)
+			return append(result, patterns[i+1:]...), true
+		}
+	}
+	return patterns, false
+}
+
+// isValidDomainPattern checks whether the given string can be used as a
+// domain pattern.
+func isValidDomainPattern(pattern string) bool {
+	pattern = strings.TrimPrefix(normalizeDomain(pattern), domainWildcardPrefix)
+	if len(pattern) == 0 || strings.ContainsAny(pattern, "*/:@ ") {
+		return false
+	}
+	_, err := idna.Lookup.ToASCII(pattern)
+	return err == nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MatchDomain(t *testing.T) {
+	assert.True(t, matchDomain("example.com", "example.com"))
+	assert.True(t, matchDomain("example.com", "EXAMPLE.com."))
+	assert.False(t, matchDomain("example.com", "www.example.com"))
+
+	assert.True(t, matchDomain("*.example.com", "example.com"))
+	assert.True(t, matchDomain("*.example.com", "www.example.com"))
+	assert.True(t, matchDomain("*.example.com", "a.b.example.com"))
+	assert.False(t, matchDomain("*.example.com", "badexample.com"))
+
+	assert.True(t, matchDomain("*.bücher.example", "www.xn--bcher-kva.example"))
+}
+
+func Test_DomainPatternList(t *testing.T) {
+	patterns, added := addDomainPattern(nil, "*.Example.com")
+	assert.True(t, added)
+	patterns, added = addDomainPattern(patterns, "*.example.com.")
+	assert.False(t, added)
+	assert.Equal(t, []string{"*.example.com"}, patterns)
+
+	assert.True(t, matchDomainList(patterns, "www.example.com"))
+	assert.False(t, matchDomainList(patterns, "example.org"))
+
+	patterns, removed := removeDomainPattern(patterns, "*.EXAMPLE.com")
+	assert.True(t, removed)
+	assert.Empty(t, patterns)
+}
+
+func Test_IsValidDomainPattern(t *testing.T) {
+	assert.True(t, isValidDomainPattern("example.com"))
+	assert.True(t, isValidDomainPattern("*.example.com"))
+	assert.False(t, isValidDomainPattern("*"))
+	assert.False(t, isValidDomainPattern("http://example.com/"))
+	assert.False(t, isValidDomainPattern("ex*ample.com"))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// helpInfo describes what this bot instance can do, used to build the help
+// text.
+type helpInfo struct {
+	// CommandPrefix is the prefix of channel commands.
+	CommandPrefix string
+	// ControlCommand is the name of the command channel operators use to
+	// control the bot.
+	ControlCommand string
+	// SearchCommands contains the names of the available search commands.
+	SearchCommands []string
+	// HasOwners is set if admin commands are available.
+	HasOwners bool
+
+	OwnerNickname string
+	OwnerChannel  string
+}
+
+// Lines returns the help text.
+func (h *helpInfo) Lines() []string {
+	lines := []string{
+		"I show information about links people post to the channels I am in. You can also send me a link right here to preview it.",
+		fmt.Sprintf("Channel operators can control me using %s%s status|on|off|parsers|shorthands|domains|ignore|unignore|set.",
+			h.CommandPrefix, h.ControlCommand),
+	}
+	if len(h.SearchCommands) > 0 {
+		commands := make([]string, len(h.SearchCommands))
+		for i, name := range h.SearchCommands {
+			commands[i] = h.CommandPrefix + name
+		}
+		lines = append(lines, fmt.Sprintf("Search from any channel I am in using %s followed by your search terms.",
+			strings.Join(commands, ", ")))
+	}
+	if h.HasOwners {
+		lines = append(lines, "My owners can also use JOIN, PART, RELOAD, STATS, CLEARCACHE, IGNORE, UNIGNORE and RESTART here.")
+	}
+	lines = append(lines, fmt.Sprintf("If you have questions or got any bug reports, please direct them to %s in %s, thank you!",
+		h.OwnerNickname, h.OwnerChannel))
+	return lines
+}
+
+// newHelpCommand creates the handler for the HELP command.
+func newHelpCommand(conn ircReplier, help *helpInfo) commandHandlerFunc {
+	return func(cmd *commandContext) {
+		if cmd.IsChannel {
+			return
+		}
+		for _, line := range help.Lines() {
+			conn.Notice(cmd.Nick, line)
+		}
+	}
+}
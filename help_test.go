@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HelpInfo_Lines(t *testing.T) {
+	help := &helpInfo{
+		CommandPrefix:  "!",
+		ControlCommand: "medialink",
+		OwnerNickname:  "Icedream",
+		OwnerChannel:   "#MediaLink",
+	}
+	lines := help.Lines()
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[1], "!medialink status")
+	assert.Contains(t, lines[2], "Icedream in #MediaLink")
+
+	help.SearchCommands = []string{"yt", "wp"}
+	help.HasOwners = true
+	lines = help.Lines()
+	assert.Len(t, lines, 5)
+	assert.Contains(t, lines[2], "!yt, !wp")
+	assert.Contains(t, lines[3], "RESTART")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseHeaderFlags parses headers given like "example.com=Name: value" into
+// the headers to send to each domain.
+func parseHeaderFlags(values []string) (map[string]http.Header, error) {
+	headers := map[string]http.Header{}
+	for _, value := range values {
+		domain, header, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing domain in header %q, expected domain=Name: value", value)
+		}
+		name, headerValue, ok := strings.Cut(header, ":")
+		domain, name = strings.TrimSpace(domain), strings.TrimSpace(name)
+		if !ok || len(domain) == 0 || len(name) == 0 {
+			return nil, fmt.Errorf("invalid header %q, expected domain=Name: value", value)
+		}
+		domain = normalizeDomain(domain)
+		if headers[domain] == nil {
+			headers[domain] = http.Header{}
+		}
+		headers[domain].Add(name, strings.TrimSpace(headerValue))
+	}
+	return headers, nil
+}
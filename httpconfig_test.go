@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseHeaderFlags(t *testing.T) {
+	headers, err := parseHeaderFlags([]string{
+		"Example.com=Authorization: Bearer abc",
+		"example.com=X-Test:  a=b ",
+		"api.example.org=Accept: application/json",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]http.Header{
+		"example.com": {
+			"Authorization": {"Bearer abc"},
+			"X-Test":        {"a=b"},
+		},
+		"api.example.org": {
+			"Accept": {"application/json"},
+		},
+	}, headers)
+
+	for _, invalid := range []string{
+		"Authorization: Bearer abc",
+		"example.com=Authorization",
+		"=Authorization: Bearer abc",
+		"example.com=: value",
+	} {
+		_, err := parseHeaderFlags([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
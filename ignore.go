@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+)
+
+// ignoreAccountPrefix marks ignore masks that match services accounts, using
+// the same syntax as the account extban on most servers.
+const ignoreAccountPrefix = "$a:"
+
+// matchIgnoreMask checks whether the given ignore mask matches the sender of
+// a message.
+//
+// Masks can be in one of these formats:
+//   - "$a:account" matches the services account of the user.
+//   - "nick!user@host" matches the full hostmask of the user.
+//   - "nick" matches only the nickname of the user.
+//
+// All formats support * and ? as wildcards.
+func matchIgnoreMask(mask string, sender *messageSender) bool {
+	switch {
+	case strings.HasPrefix(mask, ignoreAccountPrefix):
+		return len(sender.Account) > 0 && matchMask(mask[len(ignoreAccountPrefix):], sender.Account)
+	case strings.ContainsAny(mask, "!@"):
+		return matchMask(mask, sender.Source)
+	default:
+		return matchMask(mask, sender.Nick)
+	}
+}
+
+// matchIgnoreList checks whether any of the given ignore masks matches the
+// sender of a message.
+func matchIgnoreList(masks []string, sender *messageSender) bool {
+	for _, mask := range masks {
+		if matchIgnoreMask(mask, sender) {
+			return true
+		}
+	}
+	return false
+}
+
+// addIgnoreMask adds a mask to an ignore list unless it is already on it.
+func addIgnoreMask(masks []string, mask string) ([]string, bool) {
+	for _, existingMask := range masks {
+		if isSameName(existingMask, mask) {
+			return masks, false
+		}
+	}
+	return append(masks, mask), true
+}
+
+// removeIgnoreMask removes a mask from an ignore list.
+func removeIgnoreMask(masks []string, mask string) ([]string, bool) {
+	for i, existingMask := range masks {
+		if isSameName(existingMask, mask) {
+			result := append([]string{}, masks[0:i]...)
+			return append(result, masks[i+1:]...), true
+		}
+	}
+	return masks, false
+}
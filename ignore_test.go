@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MatchIgnoreMask(t *testing.T) {
+	sender := &messageSender{
+		Nick:    "SpamBot",
+		Source:  "SpamBot!spam@bots.example.com",
+		Account: "spammer",
+	}
+
+	assert.True(t, matchIgnoreMask("spambot", sender))
+	assert.True(t, matchIgnoreMask("Spam*", sender))
+	assert.False(t, matchIgnoreMask("Spam", sender))
+
+	assert.True(t, matchIgnoreMask("*!*@bots.example.com", sender))
+	assert.True(t, matchIgnoreMask("*@*.example.com", sender))
+	assert.False(t, matchIgnoreMask("*!*@example.com", sender))
+
+	assert.True(t, matchIgnoreMask("$a:Spammer", sender))
+	assert.False(t, matchIgnoreMask("$a:someone", sender))
+	assert.False(t, matchIgnoreMask("$a:*", &messageSender{Nick: "guest"}))
+}
+
+func Test_IgnoreList(t *testing.T) {
+	masks, added := addIgnoreMask(nil, "foo")
+	assert.True(t, added)
+	masks, added = addIgnoreMask(masks, "FOO")
+	assert.False(t, added)
+	masks, _ = addIgnoreMask(masks, "$a:bar")
+	assert.Equal(t, []string{"foo", "$a:bar"}, masks)
+
+	assert.True(t, matchIgnoreList(masks, &messageSender{Nick: "Foo", Source: "Foo!a@b"}))
+	assert.False(t, matchIgnoreList(masks, &messageSender{Nick: "baz", Source: "baz!a@b"}))
+
+	masks, removed := removeIgnoreMask(masks, "Foo")
+	assert.True(t, removed)
+	_, removed = removeIgnoreMask(masks, "foo")
+	assert.False(t, removed)
+	assert.Equal(t, []string{"$a:bar"}, masks)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// Case mappings as advertised by the CASEMAPPING token.
+const (
+	caseMappingASCII         = "ascii"
+	caseMappingRFC1459       = "rfc1459"
+	caseMappingStrictRFC1459 = "strict-rfc1459"
+)
+
+// Types of channel modes as categorized by the CHANMODES token.
+type channelModeType uint8
+
+const (
+	// channelModeTypeFlag modes never take a parameter (CHANMODES type D).
+	channelModeTypeFlag channelModeType = iota
+	// channelModeTypeList modes add or remove an address to a list and
+	// always take a parameter (CHANMODES type A).
+	channelModeTypeList
+	// channelModeTypeParam modes always take a parameter (CHANMODES type B).
+	channelModeTypeParam
+	// channelModeTypeParamWhenSet modes only take a parameter when being set
+	// (CHANMODES type C).
+	channelModeTypeParamWhenSet
+	// channelModeTypePrefix modes give a channel member a privilege and always
+	// take a nickname as parameter (PREFIX).
+	channelModeTypePrefix
+)
+
+// isupport keeps track of the RPL_ISUPPORT (005) tokens sent by the server.
+type isupport struct {
+	lock sync.RWMutex
+
+	tokens map[string]string
+
+	chanTypes     string
+	chanModes     [4]string
+	prefixModes   string
+	prefixSymbols string
+	caseMapping   string
+}
+
+var serverSupport = newISupport()
+
+func newISupport() *isupport {
+	s := new(isupport)
+	s.Reset()
+	return s
+}
+
+// Reset restores the defaults as defined by RFC 1459, to be called whenever
+// we (re)connect to a server.
+func (s *isupport) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tokens = map[string]string{}
+	s.chanTypes = "#&"
+	s.chanModes = [4]string{"b", "k", "l", "imnpst"}
+	s.prefixModes = "ov"
+	s.prefixSymbols = "@+"
+	s.caseMapping = caseMappingRFC1459
+}
+
+// Parse handles the tokens of a single RPL_ISUPPORT message. The arguments
+// are expected to not contain our own nickname nor the trailing
+// "are supported by this server" text.
+func (s *isupport) Parse(tokens []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, token := range tokens {
+		if len(token) == 0 {
+			continue
+		}
+
+		// Negated tokens reset the parameter to its default
+		if token[0] == '-' {
+			name := strings.ToUpper(token[1:])
+			delete(s.tokens, name)
+			s.applyToken(name, "", true)
+			continue
+		}
+
+		name, value := token, ""
+		if i := strings.IndexRune(token, '='); i >= 0 {
+			name, value = token[0:i], token[i+1:]
+		}
+		name = strings.ToUpper(name)
+		s.tokens[name] = value
+		s.applyToken(name, value, false)
+	}
+}
+
+func (s *isupport) applyToken(name, value string, negated bool) {
+	switch name {
+	case "CHANTYPES":
+		if negated {
+			s.chanTypes = "#&"
+		} else {
+			s.chanTypes = value
+		}
+	case "CHANMODES":
+		if negated {
+			s.chanModes = [4]string{"b", "k", "l", "imnpst"}
+			return
+		}
+		// Servers may send more than four types, everything beyond the
+		// fourth type has to be ignored.
+		parts := strings.SplitN(value, ",", 5)
+		s.chanModes = [4]string{}
+		for i := 0; i < len(parts) && i < len(s.chanModes); i++ {
+			s.chanModes[i] = parts[i]
+		}
+	case "PREFIX":
+		if negated {
+			s.prefixModes, s.prefixSymbols = "ov", "@+"
+			return
+		}
+		// Example: (qaohv)~&@%+
+		s.prefixModes, s.prefixSymbols = "", ""
+		if !strings.HasPrefix(value, "(") {
+			return
+		}
+		end := strings.IndexRune(value, ')')
+		if end < 0 {
+			return
+		}
+		modes, symbols := value[1:end], value[end+1:]
+		if len(modes) != len(symbols) {
+			return
+		}
+		s.prefixModes, s.prefixSymbols = modes, symbols
+	case "CASEMAPPING":
+		if negated {
+			s.caseMapping = caseMappingRFC1459
+		} else {
+			s.caseMapping = strings.ToLower(value)
+		}
+	}
+}
+
+// Token returns the raw value of the given token and whether it has been
+// advertised by the server.
+func (s *isupport) Token(name string) (value string, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	value, ok = s.tokens[strings.ToUpper(name)]
+	return
+}
+
+// IsChannel checks whether the given target is a channel name according to
+// the CHANTYPES token.
+func (s *isupport) IsChannel(target string) bool {
+	if len(target) == 0 {
+		return false
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return strings.IndexByte(s.chanTypes, target[0]) >= 0
+}
+
+// ChannelModeType returns how the given channel mode handles parameters.
+func (s *isupport) ChannelModeType(mode rune) channelModeType {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	switch {
+	case strings.ContainsRune(s.prefixModes, mode):
+		return channelModeTypePrefix
+	case strings.ContainsRune(s.chanModes[0], mode):
+		return channelModeTypeList
+	case strings.ContainsRune(s.chanModes[1], mode):
+		return channelModeTypeParam
+	case strings.ContainsRune(s.chanModes[2], mode):
+		return channelModeTypeParamWhenSet
+	default:
+		return channelModeTypeFlag
+	}
+}
+
+// ModeTakesParam checks whether the given channel mode consumes a parameter
+// from the MODE message when being set (add = true) or unset.
+func (s *isupport) ModeTakesParam(mode rune, add bool) bool {
+	switch s.ChannelModeType(mode) {
+	case channelModeTypeList, channelModeTypeParam, channelModeTypePrefix:
+		return true
+	case channelModeTypeParamWhenSet:
+		return add
+	default:
+		return false
+	}
+}
+
+// Prefixes returns the channel member privilege modes and the respective
+// symbols, ordered from highest to lowest privilege.
+func (s *isupport) Prefixes() (modes string, symbols string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.prefixModes, s.prefixSymbols
+}
+
+// Fold converts a nickname or channel name to its canonical lowercase form
+// according to the CASEMAPPING token.
+func (s *isupport) Fold(name string) string {
+	s.lock.RLock()
+	caseMapping := s.caseMapping
+	s.lock.RUnlock()
+
+	return foldWithCaseMapping(caseMapping, name)
+}
+
+// Equal compares two nicknames or channel names according to the
+// CASEMAPPING token.
+func (s *isupport) Equal(a, b string) bool {
+	return s.Fold(a) == s.Fold(b)
+}
+
+func foldWithCaseMapping(caseMapping, name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		case caseMapping == caseMappingASCII:
+			return r
+		case r == '[':
+			return '{'
+		case r == ']':
+			return '}'
+		case r == '\\':
+			return '|'
+		case r == '^' && caseMapping != caseMappingStrictRFC1459:
+			return '~'
+		default:
+			return r
+		}
+	}, name)
+}
+
+// isChannelName checks whether the given target is a channel on the current
+// server.
+func isChannelName(target string) bool {
+	return serverSupport.IsChannel(target)
+}
+
+// foldName converts a nickname or channel name to its canonical form on the
+// current server.
+func foldName(name string) string {
+	return serverSupport.Fold(name)
+}
+
+// isSameName compares nicknames or channel names on the current server.
+func isSameName(a, b string) bool {
+	return serverSupport.Equal(a, b)
+}
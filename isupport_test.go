@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ISupport_Defaults(t *testing.T) {
+	s := newISupport()
+
+	assert.True(t, s.IsChannel("#test"))
+	assert.True(t, s.IsChannel("&test"))
+	assert.False(t, s.IsChannel("!test"))
+	assert.False(t, s.IsChannel(""))
+	assert.Equal(t, channelModeTypeList, s.ChannelModeType('b'))
+	assert.Equal(t, channelModeTypeParam, s.ChannelModeType('k'))
+	assert.Equal(t, channelModeTypeParamWhenSet, s.ChannelModeType('l'))
+	assert.Equal(t, channelModeTypePrefix, s.ChannelModeType('o'))
+	assert.Equal(t, channelModeTypeFlag, s.ChannelModeType('n'))
+}
+
+func Test_ISupport_Parse(t *testing.T) {
+	s := newISupport()
+	s.Parse([]string{
+		"CHANTYPES=#!",
+		"CHANMODES=beI,k,l,BCMNORScimnpstz",
+		"PREFIX=(qaohv)~&@%+",
+		"CASEMAPPING=ascii",
+		"NETWORK=Test",
+		"SAFELIST",
+	})
+
+	assert.True(t, s.IsChannel("!test"))
+	assert.False(t, s.IsChannel("&test"))
+	assert.Equal(t, channelModeTypeList, s.ChannelModeType('I'))
+	assert.Equal(t, channelModeTypeFlag, s.ChannelModeType('c'))
+	assert.Equal(t, channelModeTypePrefix, s.ChannelModeType('h'))
+
+	modes, symbols := s.Prefixes()
+	assert.Equal(t, "qaohv", modes)
+	assert.Equal(t, "~&@%+", symbols)
+
+	network, ok := s.Token("network")
+	assert.True(t, ok)
+	assert.Equal(t, "Test", network)
+	_, ok = s.Token("SAFELIST")
+	assert.True(t, ok)
+
+	s.Parse([]string{"-CHANTYPES", "-SAFELIST"})
+	assert.True(t, s.IsChannel("&test"))
+	_, ok = s.Token("SAFELIST")
+	assert.False(t, ok)
+}
+
+func Test_ISupport_CaseMapping(t *testing.T) {
+	s := newISupport()
+	assert.Equal(t, "#{test}|~", s.Fold("#[TEST]\\^"))
+
+	s.Parse([]string{"CASEMAPPING=strict-rfc1459"})
+	assert.Equal(t, "#{test}|^", s.Fold("#[TEST]\\^"))
+
+	s.Parse([]string{"CASEMAPPING=ascii"})
+	assert.Equal(t, "#[test]\\^", s.Fold("#[TEST]\\^"))
+	assert.True(t, s.Equal("#Test", "#tEST"))
+	assert.False(t, s.Equal("#[test]", "#{test}"))
+}
+
+func Test_ParseChannelModeChanges(t *testing.T) {
+	serverSupport.Reset()
+	defer serverSupport.Reset()
+	serverSupport.Parse([]string{"CHANMODES=beI,k,l,cimnpst"})
+
+	changes := parseChannelModeChanges("+lkb-l+ov-k+c", []string{"50", "secret", "*!*@bad", "nick1", "nick2", "secret"})
+	require.Len(t, changes, 8)
+	assert.Equal(t, channelModeChange{Add: true, Mode: 'l', Type: channelModeTypeParamWhenSet, Param: "50"}, changes[0])
+	assert.Equal(t, channelModeChange{Add: true, Mode: 'k', Type: channelModeTypeParam, Param: "secret"}, changes[1])
+	assert.Equal(t, channelModeChange{Add: true, Mode: 'b', Type: channelModeTypeList, Param: "*!*@bad"}, changes[2])
+	assert.Equal(t, channelModeChange{Add: false, Mode: 'l', Type: channelModeTypeParamWhenSet}, changes[3])
+	assert.Equal(t, channelModeChange{Add: true, Mode: 'o', Type: channelModeTypePrefix, Param: "nick1"}, changes[4])
+	assert.Equal(t, channelModeChange{Add: true, Mode: 'v', Type: channelModeTypePrefix, Param: "nick2"}, changes[5])
+	assert.Equal(t, channelModeChange{Add: false, Mode: 'k', Type: channelModeTypeParam, Param: "secret"}, changes[6])
+	assert.Equal(t, channelModeChange{Add: true, Mode: 'c', Type: channelModeTypeFlag}, changes[7])
+
+	applyChannelModeChanges("#Test", changes[:3])
+	defer deleteChannelModes("#test")
+	assert.Equal(t, "lk", getChannelModes("#TEST"))
+	key, ok := getChannelModeParam("#test", 'k')
+	assert.True(t, ok)
+	assert.Equal(t, "secret", key)
+
+	applyChannelModeChanges("#test", changes[3:])
+	assert.Equal(t, "c", getChannelModes("#test"))
+	_, ok = getChannelModeParam("#test", 'k')
+	assert.False(t, ok)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// joinState describes how far we got joining a channel we were invited to.
+type joinState int
+
+const (
+	// joinStateJoining means we sent a JOIN and wait for the server's
+	// answer.
+	joinStateJoining joinState = iota
+
+	// joinStateNeedsKey means the channel needs a key and we wait for one of
+	// the inviters to send it to us.
+	joinStateNeedsKey
+
+	// joinStateJoiningWithKey means we sent a JOIN with a key we received.
+	joinStateJoiningWithKey
+
+	// joinStateWelcoming means we joined the channel and are introducing
+	// ourselves.
+	joinStateWelcoming
+)
+
+type joinerConn interface {
+	Join(channel string)
+	Notice(target, message string)
+	Noticef(target, format string, a ...interface{})
+}
+
+// pendingJoin keeps track of a single channel we have been invited to.
+type pendingJoin struct {
+	channel     string
+	state       joinState
+	inviters    []string
+	key         string
+	keyAttempts int
+	timer       *time.Timer
+	timerID     int
+	cancel      context.CancelFunc
+}
+
+func (p *pendingJoin) hasInviter(nick string) bool {
+	for _, inviter := range p.inviters {
+		if isSameName(inviter, nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// joiner handles joining channels we are invited to, asking the inviters for
+// a key if needed. It is safe for concurrent use.
+type joiner struct {
+	lock    sync.Mutex
+	conn    joinerConn
+	pending map[string]*pendingJoin
+
+	// Timeout is how long we wait for the server or the inviters before we
+	// give up on joining a channel.
+	Timeout time.Duration
+
+	// MaxKeyAttempts is how many wrong keys we accept before giving up.
+	MaxKeyAttempts int
+
+	// OwnNick returns our current nickname, used to explain how to send us
+	// a key.
+	OwnNick func() string
+
+	// OnJoined is run in its own goroutine once we joined a channel, along
+	// with the key we used if any. The context is cancelled if we leave the
+	// channel in the meantime.
+	OnJoined func(ctx context.Context, channel string, key string, inviters []string)
+}
+
+func newJoiner(conn joinerConn, timeout time.Duration) *joiner {
+	return &joiner{
+		conn:           conn,
+		pending:        map[string]*pendingJoin{},
+		Timeout:        timeout,
+		MaxKeyAttempts: 2,
+		OwnNick:        func() string { return "" },
+	}
+}
+
+// State returns the state of joining the given channel and whether we are
+// joining it at all.
+func (j *joiner) State(channel string) (state joinState, ok bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	p, ok := j.pending[foldName(channel)]
+	if ok {
+		state = p.state
+	}
+	return
+}
+
+// Invite starts joining the given channel on behalf of the inviter.
+func (j *joiner) Invite(inviter, channel string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if p, ok := j.pending[foldName(channel)]; ok {
+		if !p.hasInviter(inviter) {
+			p.inviters = append(p.inviters, inviter)
+		}
+		if p.state == joinStateNeedsKey {
+			j.askForKey(inviter, p)
+		} else if p.state != joinStateWelcoming {
+			j.conn.Noticef(inviter, "Already in the process of joining %s, I will let you know how it goes.", p.channel)
+		}
+		return
+	}
+
+	p := &pendingJoin{
+		channel:  channel,
+		state:    joinStateJoining,
+		inviters: []string{inviter},
+	}
+	j.pending[foldName(channel)] = p
+	j.startTimer(p)
+	j.conn.Join(channel)
+}
+
+// Joined is called when we joined a channel.
+func (j *joiner) Joined(channel string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	p, ok := j.pending[foldName(channel)]
+	if !ok || p.state == joinStateWelcoming {
+		return
+	}
+	p.timer.Stop()
+	p.timerID++
+	p.state = joinStateWelcoming
+
+	if j.OnJoined == nil {
+		delete(j.pending, foldName(channel))
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go func(key string, inviters []string) {
+		defer cancel()
+		j.OnJoined(ctx, channel, key, inviters)
+
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		if j.pending[foldName(channel)] == p {
+			delete(j.pending, foldName(channel))
+		}
+	}(p.key, append([]string{}, p.inviters...))
+}
+
+// NeedsKey is called when the server tells us the channel needs a key or
+// the key we used is wrong.
+func (j *joiner) NeedsKey(channel string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	p, ok := j.pending[foldName(channel)]
+	if !ok {
+		return
+	}
+
+	switch p.state {
+	case joinStateJoining:
+		p.state = joinStateNeedsKey
+		j.startTimer(p)
+		for _, inviter := range p.inviters {
+			j.askForKey(inviter, p)
+		}
+
+	case joinStateJoiningWithKey:
+		p.keyAttempts++
+		if p.keyAttempts >= j.MaxKeyAttempts {
+			j.fail(p, "This key seems to be wrong, abandoning attempt to join "+p.channel+" for now. Please reinvite me if you want to try again.")
+			return
+		}
+		p.state = joinStateNeedsKey
+		j.startTimer(p)
+		for _, inviter := range p.inviters {
+			j.conn.Noticef(inviter, "This key seems to be wrong, please check and resend within the next %s like this: \x02/msg %s KEY %s <key>\x02",
+				j.Timeout, j.OwnNick(), p.channel)
+		}
+	}
+}
+
+// KeyReceived is called when a user sends us a key for a channel. It returns
+// false if we are not waiting for a key from that user.
+func (j *joiner) KeyReceived(sender, channel, key string) bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	p, ok := j.pending[foldName(channel)]
+	if !ok || p.state != joinStateNeedsKey || !p.hasInviter(sender) {
+		return false
+	}
+
+	j.conn.Noticef(sender, "Thank you, will try to join %s with this key!", p.channel)
+	p.state = joinStateJoiningWithKey
+	p.key = key
+	j.startTimer(p)
+	j.conn.Join(p.channel + " " + key)
+	return true
+}
+
+// Full is called when the server does not let us in since the channel is
+// full.
+func (j *joiner) Full(channel string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if p, ok := j.pending[foldName(channel)]; ok && p.state != joinStateWelcoming {
+		j.fail(p, "This channel is unfortunately full or filling too quickly, and I am not allowed in. Please try again later.")
+	}
+}
+
+// Banned is called when the server does not let us in since we are banned.
+func (j *joiner) Banned(channel string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if p, ok := j.pending[foldName(channel)]; ok && p.state != joinStateWelcoming {
+		j.fail(p, "I am unfortunately banned from this channel, abandoning attempt to join.")
+	}
+}
+
+// Left is called when we left or got kicked from a channel, which stops
+// anything still going on for it.
+func (j *joiner) Left(channel string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if p, ok := j.pending[foldName(channel)]; ok {
+		j.remove(p)
+	}
+}
+
+// Reset stops all pending joins, for example when we got disconnected.
+func (j *joiner) Reset() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	for _, p := range j.pending {
+		j.remove(p)
+	}
+}
+
+// askForKey explains to the inviter how to send us the key. The lock must be
+// held by the caller.
+func (j *joiner) askForKey(inviter string, p *pendingJoin) {
+	j.conn.Noticef(inviter, "This channel needs a key to join. You need to send the channel key to me in the next %s like this: \x02/msg %s KEY %s <key>\x02",
+		j.Timeout, j.OwnNick(), p.channel)
+}
+
+// startTimer (re)starts the timeout for the current state. The lock must be
+// held by the caller.
+func (j *joiner) startTimer(p *pendingJoin) {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timerID++
+	timerID := p.timerID
+	p.timer = time.AfterFunc(j.Timeout, func() {
+		j.lock.Lock()
+		defer j.lock.Unlock()
+
+		// Make sure nothing happened in the meantime
+		if j.pending[foldName(p.channel)] != p || p.timerID != timerID || p.state == joinStateWelcoming {
+			return
+		}
+		j.fail(p, "It took too long to join the channel "+p.channel+", abandoning attempt to join. You can try again by reinviting me.")
+	})
+}
+
+// fail removes the pending join and tells the inviters why. The lock must be
+// held by the caller.
+func (j *joiner) fail(p *pendingJoin, message string) {
+	j.remove(p)
+	for _, inviter := range p.inviters {
+		j.conn.Notice(inviter, message)
+	}
+}
+
+// remove forgets about the pending join. The lock must be held by the
+// caller.
+func (j *joiner) remove(p *pendingJoin) {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if j.pending[foldName(p.channel)] == p {
+		delete(j.pending, foldName(p.channel))
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingJoinerConn struct {
+	lock    sync.Mutex
+	joins   []string
+	notices map[string][]string
+}
+
+func newRecordingJoinerConn() *recordingJoinerConn {
+	return &recordingJoinerConn{notices: map[string][]string{}}
+}
+
+func (c *recordingJoinerConn) Join(channel string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.joins = append(c.joins, channel)
+}
+
+func (c *recordingJoinerConn) Notice(target, message string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.notices[target] = append(c.notices[target], message)
+}
+
+func (c *recordingJoinerConn) Noticef(target, format string, a ...interface{}) {
+	c.Notice(target, fmt.Sprintf(format, a...))
+}
+
+func (c *recordingJoinerConn) Notices(target string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string{}, c.notices[target]...)
+}
+
+func Test_Joiner_Key(t *testing.T) {
+	conn := newRecordingJoinerConn()
+	j := newJoiner(conn, time.Minute)
+	joined := make(chan string, 1)
+	j.OnJoined = func(ctx context.Context, channel string, key string, inviters []string) {
+		joined <- fmt.Sprint(channel, " ", key, " ", inviters)
+	}
+
+	j.Invite("Inviter", "#Channel")
+	j.Invite("Other", "#channel")
+	assert.Equal(t, []string{"#Channel"}, conn.joins)
+	assert.Len(t, conn.Notices("Other"), 1)
+
+	j.NeedsKey("#CHANNEL")
+	state, ok := j.State("#channel")
+	require.True(t, ok)
+	assert.Equal(t, joinStateNeedsKey, state)
+	assert.Len(t, conn.Notices("Inviter"), 1)
+	assert.Len(t, conn.Notices("Other"), 2)
+
+	// Only inviters may send us the key
+	assert.False(t, j.KeyReceived("Stranger", "#channel", "wrong"))
+	assert.False(t, j.KeyReceived("Inviter", "#unknown", "wrong"))
+
+	require.True(t, j.KeyReceived("inviter", "#channel", "wrong"))
+	j.NeedsKey("#channel")
+	require.True(t, j.KeyReceived("Other", "#channel", "secret"))
+	assert.Equal(t, []string{"#Channel", "#Channel wrong", "#Channel secret"}, conn.joins)
+
+	j.Joined("#Channel")
+	assert.Equal(t, "#Channel secret [Inviter Other]", <-joined)
+	assert.Eventually(t, func() bool {
+		_, ok := j.State("#channel")
+		return !ok
+	}, time.Second, time.Millisecond)
+}
+
+func Test_Joiner_WrongKey(t *testing.T) {
+	conn := newRecordingJoinerConn()
+	j := newJoiner(conn, time.Minute)
+
+	j.Invite("Inviter", "#channel")
+	for i := 0; i < j.MaxKeyAttempts; i++ {
+		j.NeedsKey("#channel")
+		require.True(t, j.KeyReceived("Inviter", "#channel", "wrong"))
+	}
+	j.NeedsKey("#channel")
+
+	_, ok := j.State("#channel")
+	assert.False(t, ok)
+	notices := conn.Notices("Inviter")
+	assert.Contains(t, notices[len(notices)-1], "abandoning")
+}
+
+func Test_Joiner_Failures(t *testing.T) {
+	conn := newRecordingJoinerConn()
+	j := newJoiner(conn, time.Minute)
+
+	j.Invite("Inviter", "#full")
+	j.Invite("Inviter", "#banned")
+	j.Full("#full")
+	j.Banned("#banned")
+
+	_, ok := j.State("#full")
+	assert.False(t, ok)
+	_, ok = j.State("#banned")
+	assert.False(t, ok)
+	assert.Len(t, conn.Notices("Inviter"), 2)
+
+	// Errors about channels we were not invited to are none of our business
+	j.Full("#other")
+	assert.Len(t, conn.Notices("Inviter"), 2)
+}
+
+func Test_Joiner_Timeout(t *testing.T) {
+	conn := newRecordingJoinerConn()
+	j := newJoiner(conn, 10*time.Millisecond)
+
+	j.Invite("Inviter", "#channel")
+	assert.Eventually(t, func() bool {
+		_, ok := j.State("#channel")
+		return !ok
+	}, time.Second, time.Millisecond)
+	assert.Len(t, conn.Notices("Inviter"), 1)
+
+	// A late JOIN does not trigger anything anymore
+	j.Joined("#channel")
+	_, ok := j.State("#channel")
+	assert.False(t, ok)
+}
+
+func Test_Joiner_Left(t *testing.T) {
+	conn := newRecordingJoinerConn()
+	j := newJoiner(conn, time.Minute)
+	cancelled := make(chan struct{})
+	j.OnJoined = func(ctx context.Context, channel string, key string, inviters []string) {
+		<-ctx.Done()
+		close(cancelled)
+	}
+
+	j.Invite("Inviter", "#channel")
+	j.Joined("#channel")
+	state, ok := j.State("#channel")
+	require.True(t, ok)
+	assert.Equal(t, joinStateWelcoming, state)
+
+	j.Left("#channel")
+	<-cancelled
+	_, ok = j.State("#channel")
+	assert.False(t, ok)
+}
+
+func Test_Joiner_Concurrent(t *testing.T) {
+	conn := newRecordingJoinerConn()
+	j := newJoiner(conn, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			channel := fmt.Sprintf("#channel%d", i%5)
+			j.Invite(fmt.Sprintf("User%d", i), channel)
+			j.NeedsKey(channel)
+			j.KeyReceived(fmt.Sprintf("User%d", i), channel, "key")
+			j.Joined(channel)
+		}(i)
+	}
+	wg.Wait()
+
+	j.Reset()
+	for i := 0; i < 5; i++ {
+		_, ok := j.State(fmt.Sprintf("#channel%d", i))
+		assert.False(t, ok)
+	}
+}
@@ -9,13 +9,15 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	irc "github.com/thoj/go-ircevent"
 	"gopkg.in/alecthomas/kingpin.v2"
-	"mvdan.cc/xurls"
 
 	"github.com/icedream/irc-medialink/manager"
 	"github.com/icedream/irc-medialink/parsers/reddit"
@@ -24,11 +26,19 @@ import (
 	"github.com/icedream/irc-medialink/parsers/web"
 	"github.com/icedream/irc-medialink/parsers/wikipedia"
 	"github.com/icedream/irc-medialink/parsers/youtube"
+	"github.com/icedream/irc-medialink/util/httpclient"
+	"github.com/icedream/irc-medialink/util/netguard"
 	"github.com/icedream/irc-medialink/version"
 )
 
 var errIsRelativeURL = errors.New("given url is relative, expected absolute")
 
+// Policies for links posted in channel notices
+const (
+	channelNoticeIgnore = "ignore"
+	channelNoticeReply  = "notice"
+)
+
 func must(err error) {
 	if err == nil {
 		return
@@ -37,28 +47,6 @@ func must(err error) {
 	log.Fatal(err)
 }
 
-type channelJoinedEvent struct {
-	Name string
-}
-
-type channelNeedsKeyEvent struct {
-	Name string
-}
-
-type channelKeyReceivedEvent struct {
-	KeySender string
-	Name      string
-	Key       string
-}
-
-type channelIsFullEvent struct {
-	Name string
-}
-
-type bannedFromChannelEvent struct {
-	Name string
-}
-
 func main() {
 	fmt.Println(version.MakeHumanReadableVersionString(false, false))
 	if timestamp, ok := version.FormattedAppBuildTime(); ok {
@@ -83,21 +71,45 @@ func main() {
 	var webEnableImages bool
 	var webAcceptLanguage string
 
+	httpConfig := httpclient.DefaultConfig()
+	var httpProxy *url.URL
+	httpHeaders := []string{}
+
 	var debug bool
 	var noInvite bool
 	var useTLS bool
-	var server string
+	servers := []string{}
+	var reconnectMinDelay time.Duration
+	var reconnectMaxDelay time.Duration
+	var nickRegainMethod string
+	var nickRegainInterval time.Duration
 	var password string
 	var timeout time.Duration
 	var pingFreq time.Duration
+	var quitMessage string
+	var shutdownTimeout time.Duration
 
 	ownerNickname := "Icedream"
 	ownerChannel := "#MediaLink"
+	ownerAccounts := []string{}
 
 	var joinTimeout time.Duration = 3 * time.Minute
+	var rejoinDelay time.Duration
+	bridgeMasks := []string{}
+	links := &linkFinder{OptOuts: &optOuts{}}
+	var bridgePattern string
+	var rejoinAttempts int
+	sensitiveURLPatterns := []string{}
+	blockedNetworks := []string{}
+	allowedNetworks := []string{}
+	var noDefaultSensitiveURLPatterns bool
 
 	var parseTimeout time.Duration = 5 * time.Second
 
+	var settingsFile string
+	var commandPrefix string
+	var channelNoticePolicy string
+
 	nickname := version.AppName
 	ident := strings.ToLower(version.AppName)
 	var nickservPw string
@@ -109,17 +121,24 @@ func main() {
 	kingpin.Flag("debug", "Enables debug mode.").Short('d').BoolVar(&debug)
 	kingpin.Flag("no-invite", "Disables auto-join on invite.").BoolVar(&noInvite)
 	kingpin.Flag("tls", "Use TLS.").BoolVar(&useTLS)
-	kingpin.Flag("server", "The server to connect to.").Short('s').StringVar(&server)
+	kingpin.Flag("server", "The server to connect to, can be given multiple times to rotate through several servers.").Short('s').StringsVar(&servers)
+	kingpin.Flag("reconnect-min-delay", "The delay before reconnecting after the connection has been lost, doubled with each failed attempt.").Default("5s").DurationVar(&reconnectMinDelay)
+	kingpin.Flag("reconnect-max-delay", "The maximum delay before reconnecting.").Default("5m").DurationVar(&reconnectMaxDelay)
 	kingpin.Flag("password", "The password to use for logging into the IRC server.").Short('p').StringVar(&password)
 	kingpin.Flag("timeout", "The timeout on the connection.").Short('t').DurationVar(&timeout)
 	kingpin.Flag("pingfreq", "The ping frequency.").DurationVar(&pingFreq)
 	kingpin.Flag("nickserv-pw", "NickServ password.").StringVar(&nickservPw)
+	kingpin.Flag("nick-regain", "How to ask NickServ to release our nickname if it is in use, requires the NickServ password.").Default(nickRegainRegain).EnumVar(&nickRegainMethod, nickRegainRegain, nickRegainGhost, nickRegainNone)
+	kingpin.Flag("nick-regain-interval", "How often to check whether our nickname is free again if the server does not support MONITOR, 0 disables checking.").Default("1m").DurationVar(&nickRegainInterval)
 	kingpin.Flag("channels", "Channels to join.").Short('c').StringsVar(&channels)
 	kingpin.Flag("join-timeout", "Timeout for joining channels.").DurationVar(&joinTimeout)
+	kingpin.Flag("rejoin-delay", "How long to wait before rejoining a channel after being kicked.").Default("10s").DurationVar(&rejoinDelay)
+	kingpin.Flag("rejoin-attempts", "How often to try rejoining a channel after being kicked, 0 disables rejoining.").Default("3").IntVar(&rejoinAttempts)
 
 	// Support config
 	kingpin.Flag("owner-channel", "Channel to refer to for support of this bot instance.").StringVar(&ownerChannel)
 	kingpin.Flag("owner-nickname", "User nickname to refer to for support of this bot instance.").StringVar(&ownerNickname)
+	kingpin.Flag("owner-account", "Services account allowed to use admin commands via private message.").StringsVar(&ownerAccounts)
 
 	// Youtube config
 	kingpin.Flag("youtube-key", "The API key to use to access the YouTube API.").StringVar(&youtubeAPIKey)
@@ -141,8 +160,39 @@ func main() {
 	kingpin.Flag("images", "Enables parsing links of images. Disabled by default for legal reasons.").BoolVar(&webEnableImages)
 	kingpin.Flag("web-language", "Which accepted languages to indicate to websites.").Default("*").StringVar(&webAcceptLanguage)
 
+	// HTTP client config
+	kingpin.Flag("http-timeout", "The maximum duration of each HTTP request including reading the response, zero means no limit besides the parse timeout.").Default("0").DurationVar(&httpConfig.Timeout)
+	kingpin.Flag("http-dial-timeout", "The maximum duration to connect to a server.").Default(httpConfig.DialTimeout.String()).DurationVar(&httpConfig.DialTimeout)
+	kingpin.Flag("http-tls-timeout", "The maximum duration of TLS handshakes.").Default(httpConfig.TLSHandshakeTimeout.String()).DurationVar(&httpConfig.TLSHandshakeTimeout)
+	kingpin.Flag("http-response-timeout", "The maximum duration to wait for response headers, zero means no limit.").Default("0").DurationVar(&httpConfig.ResponseHeaderTimeout)
+	kingpin.Flag("http-proxy", "Proxy to use for all HTTP requests, for example http://proxy:3128 or socks5://proxy:1080.").URLVar(&httpProxy)
+	kingpin.Flag("http-ca-bundle", "PEM file with certificate authorities to trust in addition to the system ones.").ExistingFileVar(&httpConfig.CABundle)
+	kingpin.Flag("http-header", "Header to send to a domain and its subdomains like example.com=Name: value, can be given multiple times.").StringsVar(&httpHeaders)
+	kingpin.Flag("http-max-idle-conns", "The maximum number of idle connections to keep open.").Default(strconv.Itoa(httpConfig.MaxIdleConns)).IntVar(&httpConfig.MaxIdleConns)
+	kingpin.Flag("http-max-idle-conns-per-host", "The maximum number of idle connections to keep open to each host.").Default(strconv.Itoa(httpConfig.MaxIdleConnsPerHost)).IntVar(&httpConfig.MaxIdleConnsPerHost)
+	kingpin.Flag("http-max-conns-per-host", "The maximum number of connections to each host, zero means no limit.").Default("0").IntVar(&httpConfig.MaxConnsPerHost)
+	kingpin.Flag("http-idle-timeout", "How long to keep idle connections open.").Default(httpConfig.IdleConnTimeout.String()).DurationVar(&httpConfig.IdleConnTimeout)
+	kingpin.Flag("user-agent", "User agent to send with HTTP requests according to --user-agent-policy.").StringVar(&httpConfig.UserAgent)
+	kingpin.Flag("user-agent-policy", "Whether to send --user-agent only if a parser does not set its own user agent (default) or with all requests (override).").Default(httpclient.UserAgentDefault).EnumVar(&httpConfig.UserAgentPolicy, httpclient.UserAgentDefault, httpclient.UserAgentOverride)
+
 	kingpin.Flag("parse-timeout", "The maximum duration for each link to be parsed.").Default("10s").DurationVar(&parseTimeout)
 
+	// Bot config
+	kingpin.Flag("settings-file", "The file to save settings changed via commands to.").Default("settings.yml").StringVar(&settingsFile)
+	kingpin.Flag("command-prefix", "The prefix for commands sent to the bot.").Default("!").StringVar(&commandPrefix)
+	kingpin.Flag("bridge", "Nickname or hostmask of a bridge bot relaying messages from other chat networks, can be given multiple times.").StringsVar(&bridgeMasks)
+	kingpin.Flag("bridge-pattern", "Regular expression extracting the actual sender (group \"nick\") and message (group \"text\") from messages relayed by bridges.").Default(defaultBridgePattern).StringVar(&bridgePattern)
+	kingpin.Flag("no-preview-marker", "Users can put this right in front of a link to keep the bot from previewing it, can be given multiple times.").Default("!", "nopreview").StringsVar(&links.OptOuts.Markers)
+	kingpin.Flag("no-preview-prefix", "The bot does not preview links in messages starting with this, can be given multiple times.").StringsVar(&links.OptOuts.MessagePrefixes)
+	kingpin.Flag("strict-links", "Only handle links with an explicit scheme such as https://.").BoolVar(&links.Strict)
+	kingpin.Flag("sensitive-url-pattern", "Regular expression matching URLs that must neither be fetched nor logged, such as links containing tokens, can be given multiple times.").StringsVar(&sensitiveURLPatterns)
+	kingpin.Flag("no-default-sensitive-url-patterns", "Only use the patterns given via --sensitive-url-pattern instead of adding them to the built-in ones. URLs containing credentials are always treated as sensitive.").BoolVar(&noDefaultSensitiveURLPatterns)
+	kingpin.Flag("block-network", "Network in CIDR notation links must not be fetched from in addition to loopback, private and link-local addresses, can be given multiple times.").StringsVar(&blockedNetworks)
+	kingpin.Flag("allow-network", "Network in CIDR notation, address or host name links may be fetched from even if it is internal, can be given multiple times.").StringsVar(&allowedNetworks)
+	kingpin.Flag("quit-message", "The message to send when quitting IRC.").StringVar(&quitMessage)
+	kingpin.Flag("shutdown-timeout", "How long to wait for links that are still being parsed when shutting down.").Default("10s").DurationVar(&shutdownTimeout)
+	kingpin.Flag("channel-notice", "How to handle links in channel notices: ignore them or reply with a notice.").Default(channelNoticeIgnore).EnumVar(&channelNoticePolicy, channelNoticeIgnore, channelNoticeReply)
+
 	kingpin.Parse()
 
 	if len(nickname) == 0 {
@@ -151,12 +201,53 @@ func main() {
 	if len(ident) == 0 {
 		log.Fatal("Ident must be longer than 0 chars.")
 	}
+	if len(commandPrefix) == 0 {
+		log.Fatal("Command prefix must be longer than 0 chars.")
+	}
+	if len(servers) == 0 {
+		log.Fatal("At least one server must be given.")
+	}
+
+	bridges, err := newBridgeRelays(bridgeMasks, bridgePattern)
+	if err != nil {
+		log.Fatal("Invalid bridge pattern: ", err)
+	}
+
+	if !noDefaultSensitiveURLPatterns {
+		sensitiveURLPatterns = append(manager.DefaultSensitiveURLPatterns, sensitiveURLPatterns...)
+	}
+	privacy, err := manager.NewPrivacyGuard(sensitiveURLPatterns)
+	if err != nil {
+		log.Fatal("Invalid sensitive URL pattern: ", err)
+	}
+
+	// Links are fetched using a transport that refuses to connect to
+	// internal addresses
+	httpConfig.Guard, err = netguard.New(blockedNetworks, allowedNetworks)
+	if err != nil {
+		log.Fatal("Invalid blocked network: ", err)
+	}
+	httpConfig.Proxy = httpProxy
+	if httpConfig.Headers, err = parseHeaderFlags(httpHeaders); err != nil {
+		log.Fatal(err)
+	}
+	httpClients, err := httpclient.NewFactory(httpConfig)
+	if err != nil {
+		log.Fatal("Invalid HTTP client settings: ", err)
+	}
+
+	// Settings
+	settings := newSettingsStore(settingsFile)
+	must(settings.Load())
 
 	// Manager
 	m := manager.NewManager()
+	m.SetPrivacyGuard(privacy)
+	m.SetHTTPClientFactory(httpClients)
 
-	// Application context
-	ctx := context.TODO()
+	// Application context, cancelled once the bot has disconnected for good
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Load youtube parser
 	if len(youtubeAPIKey) > 0 {
@@ -226,9 +317,7 @@ func main() {
 	conn.VerboseCallbackHandler = conn.Debug
 	if useTLS {
 		conn.UseTLS = true
-		conn.TLSConfig = &tls.Config{
-			ServerName: strings.SplitN(server, ":", 2)[0],
-		}
+		conn.TLSConfig = &tls.Config{}
 	}
 	conn.Password = password
 	if timeout > time.Duration(0) {
@@ -237,77 +326,442 @@ func main() {
 	if pingFreq > time.Duration(0) {
 		conn.PingFreq = pingFreq
 	}
+	conn.QuitMessage = quitMessage
+
+	// Our own nickname
+	nicks := newNickKeeper(conn, nickname)
+	nicks.ServicesPassword = nickservPw
+	nicks.ServicesMethod = nickRegainMethod
+	nicks.PollInterval = nickRegainInterval
+
+	// Users lost in netsplits
+	splits := newNetsplitTracker()
 
-	inviteEventChan := map[string]chan interface{}{}
+	isConfiguredChannel := func(channel string) bool {
+		for _, configured := range channels {
+			if isSameName(configured, channel) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Rejoining channels we got kicked from
+	rejoins := newRejoiner(conn, rejoinDelay, rejoinAttempts)
+	rejoins.OnGiveUp = func(channel string) {
+		log.Printf("Giving up on rejoining %s", channel)
+		if err := settings.RemoveJoinedChannel(channel); err != nil {
+			log.Printf("WARNING: Could not save joined channels: %s", err.Error())
+		}
+	}
+
+	// Joining channels we are invited to
+	invites := newJoiner(conn, joinTimeout)
+	invites.OwnNick = nicks.Current
+	invites.OnJoined = func(ctx context.Context, channel string, key string, inviters []string) {
+		if len(key) > 0 {
+			// The server might not tell us the key later on
+			if err := settings.SetJoinedChannelKey(channel, key); err != nil {
+				log.Printf("WARNING: Could not save joined channels: %s", err.Error())
+			}
+		}
+
+		// Introduce ourselves unless we have to leave again right away
+		select {
+		case <-time.After(1 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+		conn.Privmsgf(channel, "Thanks for inviting me, %s! I am %s, the friendly bot that shows information about links posted in this channel. I hope I can be of great help for everyone here in %s! :)", strings.Join(inviters, ", "), nicks.Current(), channel)
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+		conn.Privmsgf(channel, "If you ever run into trouble with me (or find any bugs), please use the channel %s for contact on this IRC.", ownerChannel)
+	}
+
+	// Channel commands
+	commands := newCommandRegistry(commandPrefix)
+	commands.RedactLog = privacy.RedactText
+	commands.Register(strings.ToLower(version.AppName), newMediaLinkCommand(conn, m, settings))
+
+	// IRCv3 capabilities we make use of
+	caps := newCapNegotiator(
+		"account-notify",
+		"account-tag",
+		"extended-join",
+		"message-tags",
+		"multi-prefix",
+		"userhost-in-names",
+	)
+
+	// Search commands for the parsers that support searching
+	searchCommandNames := map[string][]string{
+		"YouTube":    {"yt", "youtube"},
+		"SoundCloud": {"sc", "soundcloud"},
+		"Wikipedia":  {"wp", "wikipedia"},
+	}
+	searchCommands := []string{}
+	for _, p := range m.GetParsers() {
+		if searcher, ok := p.(manager.Searcher); ok {
+			for i, name := range searchCommandNames[p.Name()] {
+				commands.Register(name, newSearchCommand(ctx, conn, m, searcher, settings, caps, parseTimeout))
+				if i == 0 {
+					searchCommands = append(searchCommands, name)
+				}
+			}
+		}
+	}
+
+	// Commands via private message
+	privateCommands := newCommandRegistry("")
+	privateCommands.RedactLog = privacy.RedactText
+	privateCommands.Register("help", newHelpCommand(conn, &helpInfo{
+		CommandPrefix:  commandPrefix,
+		ControlCommand: strings.ToLower(version.AppName),
+		SearchCommands: searchCommands,
+		HasOwners:      len(ownerAccounts) > 0,
+		OwnerNickname:  ownerNickname,
+		OwnerChannel:   ownerChannel,
+	}))
+
+	// Admin commands via private message
+
+	// Quitting and restarting are requested by the signal handler and admin
+	// commands, which run in other goroutines than the connection loop
+	var isQuitting, restartRequested atomic.Bool
+	quitRequested := make(chan struct{})
+	quitSent := make(chan struct{})
+	tasks := new(taskTracker)
+	var quitOnce sync.Once
+	requestQuit := func(reason string, restart bool) {
+		quitOnce.Do(func() {
+			restartRequested.Store(restart)
+			isQuitting.Store(true)
+			close(quitRequested)
+			go func() {
+				defer close(quitSent)
+
+				// Let links that are being handled right now get their
+				// replies queued up before we send QUIT after them
+				drainCtx, drainCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer drainCancel()
+				if err := tasks.Close(drainCtx); err != nil {
+					log.Println("WARNING: Not all links could be handled before shutting down:", err)
+				}
+
+				if len(reason) > 0 {
+					conn.QuitMessage = reason
+				}
+				conn.Quit()
+			}()
+		})
+	}
+	accounts := newAccountLookup()
+	(&adminCommands{
+		conn:          conn,
+		manager:       m,
+		settings:      settings,
+		accounts:      accounts,
+		ownerAccounts: ownerAccounts,
+		lookupTimeout: 10 * time.Second,
+		startTime:     time.Now(),
+		Restart: func(reason string) {
+			log.Println("Requesting bot restart:", reason)
+			requestQuit(reason, true)
+		},
+		KnownAccount: func(nick string) (string, bool) {
+			// Without account-notify we would miss users logging out
+			if !caps.Enabled("account-notify") {
+				return "", false
+			}
+			return getUserAccount(nick)
+		},
+	}).Register(privateCommands)
 
 	// register callbacks
 	conn.AddCallback("001", func(e *irc.Event) { // handle RPL_WELCOME
-		// nickserv login
+		nicks.Registered(e.Arguments[0])
+
+		// Forget what the previous server told us about itself
+		serverSupport.Reset()
+		resetAllChannelMembers()
+
+		// Find out which capabilities the server supports
+		caps.Reset()
+		conn.SendRaw("CAP LS 302")
+
+		// nickserv login, naming the account in case we had to use another
+		// nickname
 		if len(nickservPw) > 0 {
-			conn.Privmsg("NickServ", "IDENTIFY "+nickservPw)
+			conn.Privmsg("NickServ", "IDENTIFY "+nicks.Wanted()+" "+nickservPw)
 			log.Print("Sent NickServ login request.")
 		}
 
 		// I am a bot! (+B user mode)
-		conn.Mode(conn.GetNick(), "+B-iw")
-
-		// Join configured channels
-		if len(channels) > 0 {
-			conn.Join(strings.Join(channels, ","))
+		conn.Mode(nicks.Current(), "+B-iw")
+
+		// Join configured channels and the ones we were in before
+		joinChannels := settings.JoinedChannels()
+	configuredChannels:
+		for _, channel := range channels {
+			for _, joined := range joinChannels {
+				if isSameName(joined.Name, channel) {
+					continue configuredChannels
+				}
+			}
+			joinChannels = append(joinChannels, joinedChannel{Name: channel})
+		}
+		for _, params := range joinParams(joinChannels) {
+			conn.Join(params)
+		}
+	})
+	conn.AddCallback("CAP", func(e *irc.Event) {
+		for _, name := range caps.Handle(e.Arguments) {
+			conn.SendRawf("CAP REQ :%s", name)
+		}
+	})
+	conn.AddCallback("005", func(e *irc.Event) { // handle RPL_ISUPPORT
+		// First argument is our nickname, last argument is the
+		// "are supported by this server" text
+		if len(e.Arguments) < 3 {
+			return
 		}
+		serverSupport.Parse(e.Arguments[1 : len(e.Arguments)-1])
 	})
 	conn.AddCallback("JOIN", func(e *irc.Event) {
 		// Is this JOIN not about us?
-		if !strings.EqualFold(e.Nick, conn.GetNick()) {
+		if !isSameName(e.Nick, nicks.Current()) {
+			member := channelMember{
+				Nick: e.Nick,
+				User: e.User,
+				Host: e.Host,
+			}
+			if caps.Enabled("extended-join") && len(e.Arguments) > 1 {
+				// Arguments: channel, account, realname
+				member.Account = parseAccountName(e.Arguments[1])
+				member.AccountKnown = true
+			}
+			addChannelMember(e.Arguments[0], member)
+
+			// Users coming back after a netsplit are no new joiners
+			if splits.IsReturning(e.Source) {
+				return
+			}
+
+			// Find out whether this user is a bot if the server can not tell
+			// us via message tags. Users sharing another channel with us are
+			// known already, and join floods must not make us flood the
+			// server with WHO requests in turn.
+			if _, ok := serverSupport.Token("BOT"); ok && !caps.Enabled("message-tags") &&
+				len(getUserChannels(e.Nick)) == 1 {
+				if m.TrackWhoRequest() {
+					log.Printf("Not asking the server whether %s is a bot due to rate limit", e.Nick)
+				} else {
+					conn.Who(e.Nick)
+				}
+			}
+
 			// Save this user's details for a temporary ignore
-			if err := m.NotifyUserJoined(e.Arguments[0], e.Source); err != nil {
+			if err := m.NotifyUserJoined(e.Arguments[0], antifloodIdentity(caps, e.Source, member.Account)); err != nil {
 				log.Printf("WARNING: User join handling returned an error, user can potentially trigger bot right away: %s", err.Error())
 			}
 			return
 		}
 
+		// Remember this channel so we can rejoin it later, the key will be
+		// saved once we receive the channel modes. Configured channels are
+		// joined anyway and must not stick around once they are removed
+		// from the configuration.
+		if !isConfiguredChannel(e.Arguments[0]) {
+			if err := settings.AddJoinedChannel(e.Arguments[0], ""); err != nil {
+				log.Printf("WARNING: Could not save joined channels: %s", err.Error())
+			}
+		}
+
 		// Request channel modes
 		resetChannelModes(e.Arguments[0])
 		conn.Mode(e.Arguments[0])
 
-		// Asynchronous notification
-		if joinChan, ok := inviteEventChan[strings.ToLower(e.Arguments[0])]; ok {
-			select {
-			case joinChan <- &channelJoinedEvent{e.Arguments[0]}:
-			default:
-			}
+		// Request member details, the server sends the names list by itself
+		deleteChannelMembers(e.Arguments[0])
+		if _, ok := serverSupport.Token("WHOX"); ok {
+			// Also ask for the accounts of the members
+			conn.SendRawf("WHO %s %%tuhnfa,%s", e.Arguments[0], whoxToken)
+		} else {
+			conn.Who(e.Arguments[0])
 		}
+
+		invites.Joined(e.Arguments[0])
+		rejoins.Joined(e.Arguments[0])
 	})
 	conn.AddCallback("PART", func(e *irc.Event) {
 		// Is this PART not about us?
-		if !strings.EqualFold(e.Nick, conn.GetNick()) {
+		if !isSameName(e.Nick, nicks.Current()) {
+			removeChannelMember(e.Arguments[0], e.Nick)
 			return
 		}
 
 		deleteChannelModes(e.Arguments[0])
+		deleteChannelMembers(e.Arguments[0])
+		invites.Left(e.Arguments[0])
+		rejoins.Cancel(e.Arguments[0])
+		if err := settings.RemoveJoinedChannel(e.Arguments[0]); err != nil {
+			log.Printf("WARNING: Could not save joined channels: %s", err.Error())
+		}
 	})
-	handleChannelModeChanges := func(channel, modes string) {
-		// Is this MODE for a channel?
-		isChannel := strings.HasPrefix(channel, "#")
+	conn.AddCallback("KICK", func(e *irc.Event) {
+		// Require enough arguments
+		if len(e.Arguments) < 2 {
+			return
+		}
 
-		if !isChannel {
+		// Is this KICK not about us?
+		if !isSameName(e.Arguments[1], nicks.Current()) {
+			removeChannelMember(e.Arguments[0], e.Arguments[1])
 			return
 		}
 
-		// TODO - Handle mode params
+		log.Printf("Kicked from %s by %s: %s", e.Arguments[0], e.Nick, e.Message())
+		deleteChannelModes(e.Arguments[0])
+		deleteChannelMembers(e.Arguments[0])
+		invites.Left(e.Arguments[0])
 
-		add := true
-		for _, mode := range modes {
-			switch mode {
-			case '+':
-				add = true
-			case '-':
-				add = false
-			default:
-				if add {
-					setChannelMode(channel, mode)
-				} else {
-					unsetChannelMode(channel, mode)
+		// The channel is forgotten once we give up rejoining it
+		rejoins.Kicked(e.Arguments[0], settings.JoinedChannelKey(e.Arguments[0]))
+	})
+	conn.AddCallback("QUIT", func(e *irc.Event) {
+		if isNetsplitQuit(e.Message()) {
+			splits.Split(e.Source)
+		}
+		removeUserFromAllChannels(e.Nick)
+		nicks.UserQuit(e.Nick)
+	})
+	conn.AddCallback("NICK", func(e *irc.Event) {
+		renameChannelMember(e.Nick, e.Message())
+		nicks.NickChanged(e.Nick, e.Message())
+	})
+
+	// Replace go-ircevent's nickname handling which renames us whenever our
+	// nickname is in use, even after registration
+	conn.ClearCallback("433")
+	conn.ClearCallback("437")
+	conn.AddCallback("433", func(e *irc.Event) { // handle ERR_NICKNAMEINUSE
+		nicks.NickUnavailable()
+	})
+	conn.AddCallback("437", func(e *irc.Event) { // handle ERR_UNAVAILRESOURCE
+		if len(e.Arguments) > 1 && !isChannelName(e.Arguments[1]) {
+			nicks.NickUnavailable()
+		}
+	})
+	conn.AddCallback("376", func(e *irc.Event) { // handle RPL_ENDOFMOTD
+		nicks.StartWatching()
+	})
+	conn.AddCallback("422", func(e *irc.Event) { // handle ERR_NOMOTD
+		nicks.StartWatching()
+	})
+	conn.AddCallback("731", func(e *irc.Event) { // handle RPL_MONOFFLINE
+		if len(e.Arguments) > 1 {
+			nicks.MonitorOffline(strings.Split(e.Arguments[1], ","))
+		}
+	})
+	conn.AddCallback("303", func(e *irc.Event) { // handle RPL_ISON
+		if len(e.Arguments) > 1 {
+			nicks.IsOnReply(strings.Fields(e.Arguments[1]))
+		}
+	})
+	conn.AddCallback("307", func(e *irc.Event) { // handle RPL_WHOISREGNICK
+		// Older services only tell us that the nickname is identified,
+		// which makes the nickname the account name
+		if len(e.Arguments) < 2 {
+			return
+		}
+		accounts.SetAccount(e.Arguments[1], e.Arguments[1])
+	})
+	conn.AddCallback("330", func(e *irc.Event) { // handle RPL_WHOISACCOUNT
+		if len(e.Arguments) < 3 {
+			return
+		}
+		accounts.SetAccount(e.Arguments[1], e.Arguments[2])
+	})
+	conn.AddCallback("318", func(e *irc.Event) { // handle RPL_ENDOFWHOIS
+		if len(e.Arguments) < 2 {
+			return
+		}
+		accounts.Finish(e.Arguments[1])
+	})
+	conn.AddCallback("401", func(e *irc.Event) { // handle ERR_NOSUCHNICK
+		if len(e.Arguments) < 2 {
+			return
+		}
+		accounts.Finish(e.Arguments[1])
+	})
+	conn.AddCallback("353", func(e *irc.Event) { // handle RPL_NAMREPLY
+		// Arguments: our nickname, channel type, channel, names
+		if len(e.Arguments) < 4 {
+			return
+		}
+
+		for _, entry := range strings.Fields(e.Arguments[3]) {
+			modes, nick, user, host := parseNamesEntry(entry)
+			addChannelMember(e.Arguments[2], channelMember{
+				Nick:  nick,
+				User:  user,
+				Host:  host,
+				Modes: modes,
+			})
+		}
+	})
+	conn.AddCallback("352", func(e *irc.Event) { // handle RPL_WHOREPLY
+		// Arguments: our nickname, channel, user, host, server, nick, flags, hopcount + realname
+		if len(e.Arguments) < 7 {
+			return
+		}
+
+		updateUserDetails(e.Arguments[5], e.Arguments[2], e.Arguments[3], parseWhoFlags(e.Arguments[6]))
+	})
+	conn.AddCallback("354", func(e *irc.Event) { // handle RPL_WHOSPCRPL
+		// Arguments: our nickname, token, user, host, nick, flags, account
+		if len(e.Arguments) < 7 || e.Arguments[1] != whoxToken {
+			return
+		}
+
+		updateUserDetails(e.Arguments[4], e.Arguments[2], e.Arguments[3], parseWhoFlags(e.Arguments[5]))
+		account := e.Arguments[6]
+		if account == "0" {
+			account = ""
+		}
+		setUserAccount(e.Arguments[4], account)
+	})
+	conn.AddCallback("ACCOUNT", func(e *irc.Event) { // account-notify
+		if len(e.Arguments) < 1 {
+			return
+		}
+		setUserAccount(e.Nick, parseAccountName(e.Arguments[0]))
+	})
+	handleChannelModeChanges := func(channel, modes string, params []string) {
+		// Is this MODE for a channel?
+		if !isChannelName(channel) {
+			return
+		}
+
+		changes := parseChannelModeChanges(modes, params)
+		applyChannelModeChanges(channel, changes)
+		for _, change := range changes {
+			if change.Type == channelModeTypePrefix && len(change.Param) > 0 {
+				setChannelMemberMode(channel, change.Param, change.Mode, change.Add)
+			}
+
+			// Keep track of the key so we can rejoin the channel, some
+			// servers hide it as "*" though
+			if change.Mode == modeKey && (!change.Add || change.Param != "*") {
+				key := ""
+				if change.Add {
+					key = change.Param
+				}
+				if err := settings.SetJoinedChannelKey(channel, key); err != nil {
+					log.Printf("WARNING: Could not save joined channels: %s", err.Error())
 				}
 			}
 		}
@@ -315,47 +769,57 @@ func main() {
 		log.Println("New modes for", channel, "are", getChannelModes(channel))
 	}
 	conn.AddCallback("MODE", func(e *irc.Event) {
-		handleChannelModeChanges(e.Arguments[0], e.Arguments[1])
+		if len(e.Arguments) < 2 {
+			return
+		}
+		handleChannelModeChanges(e.Arguments[0], e.Arguments[1], e.Arguments[2:])
 	})
 	conn.AddCallback("324", func(e *irc.Event) { // handle RPL_CHANNELMODEIS
-		// TODO - Handle mode params (fourth argument)
 		// First argument is actually our nickname here
-		handleChannelModeChanges(e.Arguments[1], e.Arguments[2])
+		if len(e.Arguments) < 3 {
+			return
+		}
+		handleChannelModeChanges(e.Arguments[1], e.Arguments[2], e.Arguments[3:])
 	})
-	if !noInvite {
-		conn.AddCallback("471", func(e *irc.Event) { // handle ERR_CHANNELISFULL
-			// Require enough arguments
+	for _, code := range []string{
+		"471", // ERR_CHANNELISFULL
+		"473", // ERR_INVITEONLYCHAN
+		"474", // ERR_BANNEDFROMCHAN
+		"475", // ERR_BADCHANNELKEY
+	} {
+		code := code
+		conn.AddCallback(code, func(e *irc.Event) {
 			if len(e.Arguments) < 2 {
 				return
 			}
 
-			// Are we trying to join this channel?
-			// (Did we set up an event channel for this?)
-			channelName := strings.ToLower(e.Arguments[1])
-			if c, ok := inviteEventChan[channelName]; ok {
-				// Asynchronous notification of goroutine from INVITE
-				c <- &channelIsFullEvent{
-					Name: e.Arguments[1],
-				}
+			// Try again later if we are rejoining after a kick
+			if rejoins.Failed(e.Arguments[1]) {
 				return
 			}
+
+			// Don't try to rejoin channels we are banned from
+			if code == "474" {
+				if err := settings.RemoveJoinedChannel(e.Arguments[1]); err != nil {
+					log.Printf("WARNING: Could not save joined channels: %s", err.Error())
+				}
+			}
 		})
-		conn.AddCallback("474", func(e *irc.Event) { // handle ERR_BANNEDFROMCHAN
+	}
+	if !noInvite {
+		conn.AddCallback("471", func(e *irc.Event) { // handle ERR_CHANNELISFULL
 			// Require enough arguments
 			if len(e.Arguments) < 2 {
 				return
 			}
-
-			// Are we trying to join this channel?
-			// (Did we set up an event channel for this?)
-			channelName := strings.ToLower(e.Arguments[1])
-			if c, ok := inviteEventChan[channelName]; ok {
-				// Asynchronous notification of goroutine from INVITE
-				c <- &bannedFromChannelEvent{
-					Name: e.Arguments[1],
-				}
+			invites.Full(e.Arguments[1])
+		})
+		conn.AddCallback("474", func(e *irc.Event) { // handle ERR_BANNEDFROMCHAN
+			// Require enough arguments
+			if len(e.Arguments) < 2 {
 				return
 			}
+			invites.Banned(e.Arguments[1])
 		})
 		conn.AddCallback("475", func(e *irc.Event) { // handle ERR_BADCHANNELKEY
 			// Example: :irc.rizon.no 475 Icedream #testchannel :Cannot join channel (+k)
@@ -364,122 +828,85 @@ func main() {
 			if len(e.Arguments) < 2 {
 				return
 			}
-
-			// Are we trying to join this channel?
-			// (Did we set up an event channel for this?)
-			channelName := strings.ToLower(e.Arguments[1])
-			if c, ok := inviteEventChan[channelName]; ok {
-				// Asynchronous notification of goroutine from INVITE
-				c <- &channelNeedsKeyEvent{
-					Name: e.Arguments[1],
-				}
-				return
-			}
+			invites.NeedsKey(e.Arguments[1])
 		})
 		conn.AddCallback("INVITE", func(e *irc.Event) {
 			// Is this INVITE not for us?
-			if !strings.EqualFold(e.Arguments[0], conn.GetNick()) {
+			if len(e.Arguments) < 2 || !isSameName(e.Arguments[0], nicks.Current()) {
 				return
 			}
-
-			// Make sure we aren't already in an INVITE process for this channel
-			channelName := strings.ToLower(e.Arguments[1])
-			if _, ok := inviteEventChan[channelName]; ok {
-				conn.Connection.Noticef(e.Nick, "Already in the process of joining %s! If nothing happens, I can be reinvited there after %s.",
-					e.Arguments[1], joinTimeout)
-				return
-			}
-
-			// We have been invited, start process of joining the channel
-			inviteEventChan[channelName] = make(chan interface{}, 1)
-			go func(events chan interface{}, sourceNick string, targetChannel string) {
-				lastKeySender := ""
-				joinAttempt := 0
-				// TODO - inviteEventChan map management requires locking, it's currently missing
-			joinWaitLoop:
-				for {
-					select {
-					case inviteEventIntf := <-events:
-						switch inviteEvent := inviteEventIntf.(type) {
-						case *channelJoinedEvent:
-							delete(inviteEventChan, targetChannel)
-							time.Sleep(1 * time.Second)
-							conn.Privmsgf(inviteEvent.Name, "Thanks for inviting me, %s! I am %s, the friendly bot that shows information about links posted in this channel. I hope I can be of great help for everyone here in %s! :)", sourceNick, conn.GetNick(), inviteEvent.Name)
-							time.Sleep(2 * time.Second)
-							conn.Privmsgf(inviteEvent.Name, "If you ever run into trouble with me (or find any bugs), please use the channel %s for contact on this IRC.", ownerChannel)
-							break joinWaitLoop
-
-						case *channelNeedsKeyEvent:
-							if len(lastKeySender) > 0 {
-								joinAttempt++
-								if joinAttempt >= 2 {
-									delete(inviteEventChan, targetChannel)
-									conn.Connection.Noticef(lastKeySender, "This key seems to be wrong, abandoning attempt to join this channel for now. Please reinvite me to %s if you want to try again.",
-										targetChannel)
-									break joinWaitLoop
-								} else {
-									conn.Connection.Noticef(lastKeySender, "This key seems to be wrong, please check and resend within the next %s like this: \x02/msg %s KEY %s <key>\x02",
-										joinTimeout.String(), conn.GetNick(), targetChannel)
-								}
-							} else {
-								conn.Connection.Noticef(sourceNick, "This channel needs a key to join. You need to send the channel key to me in the next %s like this: \x02/msg %s KEY %s <key>\x02.",
-									joinTimeout.String(), conn.GetNick(), targetChannel)
-							}
-
-						case *channelKeyReceivedEvent:
-							// did we receive this key from the correct user?
-							if !strings.EqualFold(sourceNick, inviteEvent.KeySender) {
-								// ignore for dialog logic simplicity
-								continue
-							}
-							conn.Connection.Noticef(inviteEvent.KeySender, "Thank you, will try to join %s with this key!", targetChannel)
-							conn.Join(fmt.Sprintf("%s %s", targetChannel, inviteEvent.Key))
-
-						case *channelIsFullEvent:
-							delete(inviteEventChan, targetChannel)
-							conn.Connection.Notice(sourceNick, "This channel is unfortunately full or filling too quickly, and I am not allowed in. Please try again later.")
-							break joinWaitLoop
-
-						case *bannedFromChannelEvent:
-							delete(inviteEventChan, targetChannel)
-							conn.Connection.Notice(sourceNick, "I am unfortunately banned from this channel, abandoning attempt to join.")
-							break joinWaitLoop
-						}
-
-					case <-time.After(joinTimeout):
-						conn.Connection.Noticef(sourceNick, "It took too long to join the channel %s, abandoning attempt to join. You can try again by reinviting me.",
-							targetChannel)
-						break joinWaitLoop
-					}
-				}
-			}(inviteEventChan[channelName], e.Nick, channelName)
-			conn.Join(e.Arguments[1])
+			invites.Invite(e.Nick, e.Arguments[1])
 		})
 	}
-	handleText := func(nick, target, source, msg string) {
+	isIgnoredSender := func(sender *messageSender, cs *channelSettings) bool {
+		// Is this user on the global or channel ignore list?
+		if settings.IsIgnored(sender) || matchIgnoreList(cs.Ignore, sender) {
+			return true
+		}
+
+		// Avoid talking to other bots, this can cause loops between link bots
+		if sender.IsBot && !cs.AllowBots {
+			log.Printf("Ignoring message from bot %s.", sender.Nick)
+			return true
+		}
+		return false
+	}
+
+	handleText := func(sender *messageSender, target, msg string, isNotice bool) {
 		msg = stripIrcFormatting(msg)
 
+		// Attribute messages relayed by bridges to the actual sender
+		sender, msg = bridges.Unwrap(sender, msg)
+
+		// Has link parsing been paused in this channel?
+		cs := settings.Channel(target)
+		if cs.Disabled {
+			return
+		}
+
+		if isIgnoredSender(sender, &cs) {
+			return
+		}
+
 		// Ignore user if they just joined
-		if shouldIgnore := m.TrackUser(target, source); shouldIgnore {
+		if shouldIgnore := m.TrackUser(target, sender.antifloodIdentity(caps)); shouldIgnore {
 			log.Print("This message will be ignored since the user just joined.")
 			return
 		}
 
-		urlStr := xurls.Relaxed.FindString(msg)
+		// Links wrapped in angle brackets or marked by users are skipped
+		urlStr := links.Find(msg)
+		if len(urlStr) < 1 {
+			// Maybe the user referred to something like r/golang instead
+			urlStr = links.FindShorthand(msg, cs.IsShorthandEnabled)
+		}
 		if len(urlStr) < 1 {
 			return
 		}
 
 		// Parse URL!
-		u, err := url.Parse(urlStr)
-		if err != nil || !u.IsAbs() {
-			u, err = url.Parse("http://" + urlStr)
+		if !hasScheme(urlStr) {
+			urlStr = "http://" + urlStr
 		}
+		u, err := url.Parse(urlStr)
 		if err == nil && !u.IsAbs() {
 			err = errIsRelativeURL
 		}
 		if err != nil {
-			log.Print(err)
+			// The error contains the whole URL
+			log.Printf("Not parsing invalid URL in %s: %s", target, privacy.RedactText(urlStr))
+			return
+		}
+
+		// Never fetch links that contain credentials or tokens
+		if privacy.IsSensitive(u) {
+			log.Printf("Not parsing URL in %s since it contains sensitive information: %s", target, privacy.RedactURL(u))
+			return
+		}
+
+		// Are links to this domain allowed in this channel?
+		if !cs.IsDomainAllowed(u.Hostname()) {
+			log.Printf("Not parsing URL in %s since its domain is not allowed: %s", target, u)
 			return
 		}
 
@@ -496,16 +923,20 @@ func main() {
 
 		rctx, rcancel := context.WithTimeout(ctx, parseTimeout)
 		defer rcancel()
-		_, result := m.Parse(rctx, u)
+		_, result := m.ParseWithFilter(rctx, u, func(u *url.URL) bool {
+			// Also applies to URLs parsers redirect to
+			return cs.IsDomainAllowed(u.Hostname())
+		}, func(p manager.Parser) bool {
+			return cs.IsParserEnabled(p.Name())
+		})
 		if result.Error != nil {
 			log.Print(result.Error)
 		}
-		if result.UserError != nil {
+		if result.UserError != nil && !cs.HideErrors {
 			if s, err := tplString("error", result.UserError); err != nil {
 				log.Print(err)
 			} else {
-				s = stripIrcFormattingIfChannelBlocksColors(target, s)
-				conn.Privmsg(target, s)
+				sendChannelOutput(conn, target, &cs, isNotice, s)
 			}
 		}
 		if result.Error == nil && result.UserError == nil && result.Information != nil {
@@ -513,26 +944,29 @@ func main() {
 				if s, err := tplString("link-info", i); err != nil {
 					log.Print(err)
 				} else {
-					s = stripIrcFormattingIfChannelBlocksColors(target, s)
-					conn.Privmsg(target, s)
+					sendChannelOutput(conn, target, &cs, isNotice, s)
 				}
 			}
 		}
 	}
 	conn.AddCallback("NOTICE", func(e *irc.Event) {
+		if !tasks.Start() {
+			return
+		}
 		go func(event *irc.Event) {
-			// TODO - handle channel notice
+			defer tasks.Done()
+
 			// TODO - handle private noice
 
 			// sender := event.Nick
 			target := event.Arguments[0]
 			isChannel := true
-			if strings.EqualFold(target, conn.GetNick()) {
+			if isSameName(target, nicks.Current()) {
 				// Private notice to us!
 				target = event.Nick
 				isChannel = false
 			}
-			if strings.EqualFold(target, conn.GetNick()) {
+			if isSameName(target, nicks.Current()) {
 				// Emergency switch to avoid endless loop,
 				// dropping all messages from the bot to the bot!
 				log.Printf("BUG - Emergency switch, caught message from bot to bot: %s", event.Arguments)
@@ -541,7 +975,7 @@ func main() {
 
 			msg := event.Message()
 			msg = stripIrcFormatting(msg)
-			log.Printf("<%s @ %s> Notice: %s", event.Nick, target, msg)
+			log.Printf("<%s @ %s> Notice: %s", event.Nick, target, privacy.RedactText(msg))
 
 			// Ignore system/internal messages
 			if len(e.Nick) <= 0 || len(target) <= 0 ||
@@ -557,29 +991,43 @@ func main() {
 				return
 			}
 
-			handleText(event.Nick, target, event.Source, msg)
+			// Only reply to channel notices if we are told to, bots usually
+			// should not react to notices at all
+			if channelNoticePolicy == channelNoticeIgnore {
+				return
+			}
+			handleText(senderFromEvent(event), target, msg, true)
 		}(e)
 	})
 	// Set our own version string
 	conn.Version = fmt.Sprintf("%s based on %s", version.MakeHumanReadableVersionString(true, false), irc.VERSION)
-	// Inject our own userinfo
-	conn.RemoveCallback("CTCP_USERINFO", 0)
-	conn.AddCallback("CTCP_USERINFO", func(e *irc.Event) {
-		conn.Connection.Notice(e.Nick, (&ctcpMessage{
-			Command: "USERINFO",
-			Params:  []string{"IRC bot running", version.MakeHumanReadableVersionString(true, true)},
-		}).String())
-	})
+	// Answer CTCP requests ourselves instead of using the library's handlers
+	ctcp := newCTCPDispatcher(conn.Connection, conn.Version)
+	ctcp.ShouldIgnore = func(source string) bool {
+		account, _ := getUserAccount(strings.SplitN(source, "!", 2)[0])
+		return m.TrackCTCP(antifloodIdentity(caps, source, account))
+	}
+	for _, code := range ctcpEvents {
+		conn.ClearCallback(code)
+		conn.AddCallback(code, func(e *irc.Event) {
+			ctcp.Handle(e.Nick, e.Source, e.Message())
+		})
+	}
 	conn.AddCallback("CTCP_ACTION", func(e *irc.Event) {
+		if !tasks.Start() {
+			return
+		}
+		defer tasks.Done()
+
 		// sender := event.Nick
 		target := e.Arguments[0]
 		isChannel := true
-		if strings.EqualFold(target, conn.GetNick()) {
+		if isSameName(target, nicks.Current()) {
 			// Private message to us!
 			target = e.Nick
 			isChannel = false
 		}
-		if strings.EqualFold(target, conn.GetNick()) {
+		if isSameName(target, nicks.Current()) {
 			// Emergency switch to avoid endless loop,
 			// dropping all messages from the bot to the bot!
 			log.Printf("BUG - Emergency switch, caught message from bot to bot: %s", e.Arguments)
@@ -587,7 +1035,7 @@ func main() {
 		}
 
 		msg := stripIrcFormatting(strings.Join(e.Arguments, " "))
-		log.Printf("<%s @ %s> * %s %s", e.Nick, target, e.Nick, msg)
+		log.Printf("<%s @ %s> * %s %s", e.Nick, target, e.Nick, privacy.RedactText(msg))
 
 		// Ignore system/internal messages
 		if len(e.Nick) <= 0 || len(target) <= 0 ||
@@ -603,34 +1051,24 @@ func main() {
 			return
 		}
 
-		handleText(e.Nick, target, e.Source, msg)
+		handleText(senderFromEvent(e), target, msg, false)
 	})
-	conn.AddCallback("CTCP", func(e *irc.Event) {
-		if len(e.Arguments) < 1 {
+	conn.AddCallback("PRIVMSG", func(e *irc.Event) {
+		if !tasks.Start() {
 			return
 		}
-
-		switch {
-		case strings.EqualFold(e.Arguments[0], "FINGER"):
-			conn.Connection.Notice(e.Nick, (&ctcpMessage{
-				Command: "FINGER",
-				Params:  []string{"IRC bot running", version.MakeHumanReadableVersionString(true, true)},
-			}).String())
-		default:
-			// Ignore
-		}
-	})
-	conn.AddCallback("PRIVMSG", func(e *irc.Event) {
 		go func(event *irc.Event) {
+			defer tasks.Done()
+
 			// sender := event.Nick
 			target := event.Arguments[0]
 			isChannel := true
-			if strings.EqualFold(target, conn.GetNick()) {
+			if isSameName(target, nicks.Current()) {
 				// Private message to us!
 				target = event.Nick
 				isChannel = false
 			}
-			if strings.EqualFold(target, conn.GetNick()) {
+			if isSameName(target, nicks.Current()) {
 				// Emergency switch to avoid endless loop,
 				// dropping all messages from the bot to the bot!
 				log.Printf("BUG - Emergency switch, caught message from bot to bot: %s", event.Arguments)
@@ -639,7 +1077,7 @@ func main() {
 
 			msg := event.Message()
 			msg = stripIrcFormatting(msg)
-			log.Printf("<%s @ %s> Message: %s", event.Nick, target, msg)
+			log.Printf("<%s @ %s> Message: %s", event.Nick, target, privacy.RedactText(msg))
 
 			// Ignore system/internal messages
 			if len(e.Nick) <= 0 || len(target) <= 0 ||
@@ -652,66 +1090,139 @@ func main() {
 			if !isChannel {
 				// Detect commands
 				parts := strings.Fields(msg)
+				if len(parts) == 0 {
+					return
+				}
 				switch {
 				case strings.EqualFold(parts[0], "KEY") && len(parts) >= 3: // parts: ["KEY", channel, key]
 					// check if we are even waiting for a key for this channel
-					channelName := strings.ToLower(parts[1])
-					if c, ok := inviteEventChan[channelName]; ok {
-						channelKey := parts[2]
-						if len(channelKey) <= 0 {
-							conn.Noticef(e.Nick, "You need to provide a key for this channel.")
-						} else {
-							// Asynchronous notification of the goroutine from INVITE
-							select {
-							case c <- &channelKeyReceivedEvent{
-								KeySender: e.Nick,
-								Name:      channelName,
-								Key:       channelKey,
-							}:
-							default:
-							}
-						}
+					if !invites.KeyReceived(e.Nick, parts[1], parts[2]) {
+						conn.Noticef(e.Nick, "I am not waiting for a key for %s from you.", parts[1])
 					}
 
+				case privateCommands.Handle(senderFromEvent(event), target, isChannel, msg):
+					// Command has been handled
+
+				case len(links.Find(msg)) > 0:
+					// Preview the link privately
+					sender := senderFromEvent(event)
+					if m.TrackPrivateLookup(sender.antifloodIdentity(caps)) {
+						log.Printf("Private lookup rate limit triggered for %s.", event.Source)
+						conn.Notice(target, "You are sending me links too quickly, please wait a minute.")
+						return
+					}
+					handleText(sender, target, msg, false)
+
 				default:
 					// Explain who we are and what we do
-					conn.Privmsgf(target, "Hi, I parse links people post to chat rooms to give some information about them. I also allow people to search for YouTube videos and SoundCloud sounds straight from IRC. If you have questions or got any bug reports, please direct them to %s in %s, thank you!", ownerNickname, ownerChannel)
+					conn.Privmsgf(target, "Hi, I parse links people post to chat rooms to give some information about them. I also allow people to search for YouTube videos and SoundCloud sounds straight from IRC. Send me HELP to find out what I can do. If you have questions or got any bug reports, please direct them to %s in %s, thank you!", ownerNickname, ownerChannel)
 				}
 				return
 			}
 
-			handleText(event.Nick, target, event.Source, msg)
+			if commands.IsCommand(msg) {
+				// Ignored users and other bots can't use commands either
+				sender := senderFromEvent(event)
+				cs := settings.Channel(target)
+				if !isIgnoredSender(sender, &cs) {
+					commands.Handle(sender, target, isChannel, msg)
+				}
+				return
+			}
+
+			handleText(senderFromEvent(event), target, msg, false)
 		}(e)
 	})
 
 	// listen for signals
-	isQuitting := false
 	go func() {
 		sigc := make(chan os.Signal, 1)
 		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
 		sig := <-sigc
 		log.Println("Requesting bot shutdown due to received signal:", sig)
-		isQuitting = true
-		conn.Quit()
+		requestQuit("", false)
+
+		// A second signal means we should not wait any longer
+		sig = <-sigc
+		log.Println("Forcing bot shutdown due to received signal:", sig)
+		os.Exit(1)
 	}()
 
-	// connect to server
-	log.Println("Connecting...")
-	for {
-		err := conn.Connect(server)
-		if isQuitting {
-			// ignore errors, we're shutting down!
-			break
+	// connect to server, retrying with growing delays
+	serverRotation := &serverList{servers: servers}
+	reconnectDelay := newBackoff(reconnectMinDelay, reconnectMaxDelay)
+	for !isQuitting.Load() {
+		server := serverRotation.Next()
+		if conn.TLSConfig != nil {
+			conn.TLSConfig.ServerName = strings.SplitN(server, ":", 2)[0]
 		}
-		if err == nil {
+
+		log.Printf("Connecting to %s...", server)
+		if err := connectTo(conn.Connection, server); err != nil {
+			log.Printf("Connection to %s failed: %s", server, err)
+		} else {
 			log.Println("Connected!")
+			connectedAt := time.Now()
+			var err error
+			select {
+			case err = <-conn.ErrorChan():
+			case <-quitSent:
+				// Give the server some time to acknowledge our QUIT
+				select {
+				case <-conn.ErrorChan():
+				case <-time.After(shutdownTimeout):
+				}
+			}
+			if isQuitting.Load() {
+				// ignore errors, we're shutting down!
+				break
+			}
+			log.Printf("Disconnected from %s: %s", server, err)
+			conn.Disconnect()
+			nicks.Disconnected()
+			invites.Reset()
+			rejoins.Reset()
+			splits.Reset()
+			resetAllChannelModes()
+			resetAllChannelMembers()
+
+			// Only start over with short delays if the connection was stable,
+			// otherwise keep backing off
+			if time.Since(connectedAt) > reconnectMaxDelay {
+				reconnectDelay.Reset()
+			}
+		}
+		if isQuitting.Load() {
 			break
 		}
-		log.Println("Connection failed:", err)
-		log.Println("Retrying in 10 seconds…")
-		time.Sleep(10 * time.Second)
+
+		delay := reconnectDelay.Next()
+		log.Printf("Reconnecting in %s…", delay.Round(time.Second))
+		select {
+		case <-time.After(delay):
+		case <-quitRequested:
+		}
+	}
+
+	// Let requestQuit finish draining, sending QUIT may block however if we
+	// never got connected
+	select {
+	case <-quitSent:
+	case <-time.After(shutdownTimeout):
 	}
 
-	log.Print("Now looping.")
-	conn.Loop()
+	// Stop everything still running in the background
+	cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := m.Shutdown(shutdownCtx); err != nil {
+		log.Println("WARNING: Not all links were parsed before shutting down:", err)
+	}
+	shutdownCancel()
+
+	if restartRequested.Load() {
+		log.Print("Restarting...")
+		executable, err := os.Executable()
+		must(err)
+		must(syscall.Exec(executable, os.Args, os.Environ()))
+	}
 }
@@ -214,4 +214,13 @@
 			💬{{ compactnum . }}
 		{{ end }}
 	{{ end }}
+
+	{{ if index . "IsSearchResult" }}
+		·
+		{{ if index . "ShortUrl" }}
+			{{ index . "ShortUrl" }}
+		{{ else }}
+			{{ index . "Url" }}
+		{{ end }}
+	{{ end }}
 {{ end }}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/url"
+	"runtime"
 	"strings"
 	"time"
 
@@ -15,10 +16,70 @@ import (
 	"github.com/icedream/irc-medialink/util/clone"
 )
 
+const (
+	// privateLookupLimit is the number of links a single user may look up via
+	// private message within privateLookupWindow.
+	privateLookupLimit  = 5
+	privateLookupWindow = 1 * time.Minute
+
+	// ctcpUserLimit is the number of CTCP requests we answer for a single
+	// user within ctcpWindow, ctcpGlobalLimit the number of CTCP requests we
+	// answer in total within that time. The latter keeps floods from many
+	// different users from being reflected by us.
+	ctcpUserLimit   = 3
+	ctcpGlobalLimit = 10
+	ctcpWindow      = 30 * time.Second
+
+	// adminCommandUserLimit is the number of admin commands we accept from a
+	// single user within adminCommandWindow, adminCommandGlobalLimit the
+	// number we accept in total within that time. Every admin command may
+	// require looking up the account of the user on the server.
+	adminCommandUserLimit   = 5
+	adminCommandGlobalLimit = 20
+	adminCommandWindow      = 1 * time.Minute
+
+	// whoRequestLimit is the number of WHO requests for single users we send
+	// within whoRequestWindow.
+	whoRequestLimit  = 10
+	whoRequestWindow = 30 * time.Second
+
+	// searchUserLimit is the number of searches a single user may run within
+	// searchUserWindow, searchGlobalLimit the number of searches all users
+	// together may run using the same searcher within searchGlobalWindow.
+	// Search APIs like the one of YouTube have a daily quota which allows for
+	// about a hundred searches.
+	searchUserLimit    = 3
+	searchUserWindow   = 5 * time.Minute
+	searchGlobalLimit  = 90
+	searchGlobalWindow = 24 * time.Hour
+)
+
+// identityPrefix marks user identities that are not hostmasks, such as
+// services account names.
+const identityPrefix = "$"
+
+// AccountIdentity returns what to pass instead of a hostmask as the source of
+// a user logged in to the given services account. This way users are
+// recognized even if their hostmask changes.
+func AccountIdentity(account string) string {
+	return identityPrefix + "a:" + account
+}
+
+// BridgedIdentity returns what to pass instead of a hostmask as the source of
+// a user whose messages are relayed by the given bridge bot.
+func BridgedIdentity(bridge, nick string) string {
+	return identityPrefix + "bridge:" + bridge + "/" + nick
+}
+
 func (m *Manager) initAntiflood() {
 	m.cache = cache.New(1*time.Minute, 5*time.Second)
 }
 
+// ClearCache forgets all recently seen URLs, messages and joined users.
+func (m *Manager) ClearCache() {
+	m.cache.Flush()
+}
+
 func (m *Manager) TrackUser(target string, source string) (shouldIgnore bool) {
 	key := normalizeUserAntiflood(target, source)
 
@@ -43,6 +104,67 @@ func (m *Manager) NotifyUserJoined(target string, source string) error {
 	return nil
 }
 
+// TrackPrivateLookup counts a link lookup the given user requested via
+// private message and reports whether they exceeded the rate limit.
+func (m *Manager) TrackPrivateLookup(source string) (shouldIgnore bool) {
+	key := "LOOKUP/" + normalizeUserAntiflood("", source)
+	return m.countWithin(key, privateLookupWindow) > privateLookupLimit
+}
+
+// TrackCTCP counts a CTCP request sent by the given user and reports whether
+// either they or all users together exceeded the rate limit.
+func (m *Manager) TrackCTCP(source string) (shouldIgnore bool) {
+	key := "CTCP/" + normalizeUserAntiflood("", source)
+	if m.countWithin(key, ctcpWindow) > ctcpUserLimit {
+		// Don't let a single user eat up the global limit
+		return true
+	}
+	return m.countWithin("CTCP", ctcpWindow) > ctcpGlobalLimit
+}
+
+// TrackAdminCommand counts an admin command sent by the given user and
+// reports whether either they or all users together exceeded the rate limit.
+func (m *Manager) TrackAdminCommand(source string) (shouldIgnore bool) {
+	key := "ADMIN/" + normalizeUserAntiflood("", source)
+	if m.countWithin(key, adminCommandWindow) > adminCommandUserLimit {
+		return true
+	}
+	return m.countWithin("ADMIN", adminCommandWindow) > adminCommandGlobalLimit
+}
+
+// TrackWhoRequest counts a WHO request we are about to send for a joining
+// user and reports whether we exceeded the rate limit.
+func (m *Manager) TrackWhoRequest() (shouldIgnore bool) {
+	return m.countWithin("WHO", whoRequestWindow) > whoRequestLimit
+}
+
+// TrackSearch counts a search the given user runs using the given searcher
+// and reports whether either they or all users together exceeded the rate
+// limit.
+func (m *Manager) TrackSearch(searcher string, source string) (shouldIgnore bool) {
+	key := "SEARCH/" + normalizeUserAntiflood("", source)
+	if m.countWithin(key, searchUserWindow) > searchUserLimit {
+		return true
+	}
+	return m.countWithin("SEARCH/"+searcher, searchGlobalWindow) > searchGlobalLimit
+}
+
+// countWithin increments the counter with the given key and returns its new
+// value. The counter starts over once the window has passed since it was
+// first incremented.
+func (m *Manager) countWithin(key string, window time.Duration) int {
+	if err := m.cache.Add(key, 1, window); err == nil {
+		// First time within the window
+		return 1
+	}
+	count, err := m.cache.IncrementInt(key, 1)
+	if err != nil {
+		// Entry expired in the meantime
+		return 1
+	}
+	return count
+}
+
 func (m *Manager) TrackUrl(target string, u *url.URL) (shouldIgnore bool, err error) {
 	key := normalizeUrlAntiflood(target, u)
 
@@ -114,6 +236,10 @@ func normalizeTextAntiflood(target, text string) string {
 }
 
 func normalizeUserAntiflood(target, source string) string {
+	if strings.HasPrefix(source, identityPrefix) {
+		return fmt.Sprintf("USER/%s/%s", strings.ToUpper(target), strings.ToLower(source))
+	}
+
 	sourceSplitHost := strings.SplitN(source, "@", 2)
 	if len(sourceSplitHost) > 1 {
 		sourceSplitHostname := strings.Split(sourceSplitHost[1], ".")
@@ -126,13 +252,65 @@ func normalizeUserAntiflood(target, source string) string {
 	return fmt.Sprintf("USER/%s/%s", strings.ToUpper(target), source)
 }
 
-// Proxies several methods of the IRC connection in order to drop repeated messages
+// Proxies several methods of the IRC connection in order to drop repeated
+// messages and messages sent while we are disconnected
 type ircConnectionProxy struct {
 	*irc.Connection
 
 	m *Manager
 }
 
+// dropIfDisconnected recovers from sending a message on a connection that has
+// been disconnected in the meantime, dropping the message instead of crashing.
+func dropIfDisconnected() {
+	if r := recover(); r != nil {
+		if err, ok := r.(runtime.Error); ok && strings.Contains(err.Error(), "send on closed channel") {
+			log.Print("WARNING: Dropping message since we are disconnected")
+			return
+		}
+		panic(r)
+	}
+}
+
+func (proxy *ircConnectionProxy) SendRaw(message string) {
+	defer dropIfDisconnected()
+	proxy.Connection.SendRaw(message)
+}
+
+func (proxy *ircConnectionProxy) SendRawf(format string, a ...interface{}) {
+	proxy.SendRaw(fmt.Sprintf(format, a...))
+}
+
+func (proxy *ircConnectionProxy) Join(channel string) {
+	defer dropIfDisconnected()
+	proxy.Connection.Join(channel)
+}
+
+func (proxy *ircConnectionProxy) Part(channel string) {
+	defer dropIfDisconnected()
+	proxy.Connection.Part(channel)
+}
+
+func (proxy *ircConnectionProxy) Mode(target string, modestring ...string) {
+	defer dropIfDisconnected()
+	proxy.Connection.Mode(target, modestring...)
+}
+
+func (proxy *ircConnectionProxy) Who(nick string) {
+	defer dropIfDisconnected()
+	proxy.Connection.Who(nick)
+}
+
+func (proxy *ircConnectionProxy) Whois(nick string) {
+	defer dropIfDisconnected()
+	proxy.Connection.Whois(nick)
+}
+
+func (proxy *ircConnectionProxy) Quit() {
+	defer dropIfDisconnected()
+	proxy.Connection.Quit()
+}
+
 func (proxy *ircConnectionProxy) Action(target, message string) {
 	if shouldNotSend, err := proxy.m.TrackOutput(target, message); err != nil {
 		log.Printf("WARNING: Output antiflood returned an error, dropping message for %s: %s", target, err.Error())
@@ -142,6 +320,7 @@ func (proxy *ircConnectionProxy) Action(target, message string) {
 		return
 	}
 
+	defer dropIfDisconnected()
 	proxy.Connection.Action(target, message)
 }
 
@@ -158,6 +337,7 @@ func (proxy *ircConnectionProxy) Privmsg(target, message string) {
 		return
 	}
 
+	defer dropIfDisconnected()
 	proxy.Connection.Privmsg(target, message)
 }
 
@@ -174,6 +354,7 @@ func (proxy *ircConnectionProxy) Notice(target, message string) {
 		return
 	}
 
+	defer dropIfDisconnected()
 	proxy.Connection.Notice(target, message)
 }
 
@@ -1,6 +1,7 @@
 package manager_test
 
 import (
+	"fmt"
 	"net/url"
 	"testing"
 
@@ -32,3 +33,90 @@ func TestAntiflood_URL_Punycode(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, shouldIgnore)
 }
+
+func TestAntiflood_PrivateLookup(t *testing.T) {
+	m := manager.NewManager()
+	for i := 0; i < 5; i++ {
+		require.False(t, m.TrackPrivateLookup("someone!user@example.com"))
+	}
+	require.True(t, m.TrackPrivateLookup("someone!user@example.com"))
+
+	// Same host counts as the same user
+	require.True(t, m.TrackPrivateLookup("other!ident@example.com"))
+	require.False(t, m.TrackPrivateLookup("someone!user@example.net"))
+
+	m.ClearCache()
+	require.False(t, m.TrackPrivateLookup("someone!user@example.com"))
+}
+
+func TestAntiflood_CTCP(t *testing.T) {
+	m := manager.NewManager()
+	for i := 0; i < 3; i++ {
+		require.False(t, m.TrackCTCP("someone!user@example.com"))
+	}
+	require.True(t, m.TrackCTCP("someone!user@example.com"))
+
+	// Requests from other users count towards the global limit
+	for i := 0; i < 7; i++ {
+		require.False(t, m.TrackCTCP(fmt.Sprintf("user%d!user@%d.example.net", i, i)))
+	}
+	require.True(t, m.TrackCTCP("late!user@example.org"))
+}
+
+func TestAntiflood_AdminCommand(t *testing.T) {
+	m := manager.NewManager()
+	for i := 0; i < 5; i++ {
+		require.False(t, m.TrackAdminCommand("someone!user@example.com"))
+	}
+	require.True(t, m.TrackAdminCommand("someone!user@example.com"))
+
+	// Commands from other users count towards the global limit
+	for i := 0; i < 15; i++ {
+		require.False(t, m.TrackAdminCommand(fmt.Sprintf("user%d!user@%d.example.net", i, i)))
+	}
+	require.True(t, m.TrackAdminCommand("late!user@example.org"))
+}
+
+func TestAntiflood_WhoRequest(t *testing.T) {
+	m := manager.NewManager()
+	for i := 0; i < 10; i++ {
+		require.False(t, m.TrackWhoRequest())
+	}
+	require.True(t, m.TrackWhoRequest())
+}
+
+func TestAntiflood_Search(t *testing.T) {
+	m := manager.NewManager()
+	for i := 0; i < 3; i++ {
+		require.False(t, m.TrackSearch("YouTube", "someone!user@example.com"))
+	}
+	require.True(t, m.TrackSearch("YouTube", "someone!user@example.com"))
+
+	// Searches by other users count towards the global limit of each
+	// searcher
+	for i := 0; i < 87; i++ {
+		require.False(t, m.TrackSearch("YouTube", fmt.Sprintf("user%d!user@%d.example.net", i, i)))
+	}
+	require.True(t, m.TrackSearch("YouTube", "late!user@example.org"))
+	require.False(t, m.TrackSearch("SoundCloud", "late!user@example.org"))
+}
+
+func TestAntiflood_AccountIdentity(t *testing.T) {
+	m := manager.NewManager()
+	require.NoError(t, m.NotifyUserJoined("#test", manager.AccountIdentity("Account")))
+	require.True(t, m.TrackUser("#test", manager.AccountIdentity("account")))
+	require.False(t, m.TrackUser("#test", manager.AccountIdentity("other")))
+
+	// Account names never match hostmasks
+	require.NoError(t, m.NotifyUserJoined("#test", "nick!user@example.com"))
+	require.False(t, m.TrackUser("#test", manager.AccountIdentity("example.com")))
+}
+
+func TestAntiflood_BridgedIdentity(t *testing.T) {
+	m := manager.NewManager()
+	for i := 0; i < 5; i++ {
+		require.False(t, m.TrackPrivateLookup(manager.BridgedIdentity("Bridge", "alice")))
+	}
+	require.True(t, m.TrackPrivateLookup(manager.BridgedIdentity("Bridge", "Alice")))
+	require.False(t, m.TrackPrivateLookup(manager.BridgedIdentity("Bridge", "bob")))
+}
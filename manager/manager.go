@@ -4,6 +4,8 @@ import (
 	"sync"
 
 	"github.com/patrickmn/go-cache"
+
+	"github.com/icedream/irc-medialink/util/httpclient"
 )
 
 type Manager struct {
@@ -13,10 +15,18 @@ type Manager struct {
 	// parser variables
 	stateLock         sync.RWMutex
 	registeredParsers []Parser
+	shuttingDown      bool
+	runningParses     sync.WaitGroup
+	privacyGuard      *PrivacyGuard
+	httpClients       *httpclient.Factory
+
+	stats statsCounters
 }
 
 func NewManager() *Manager {
 	m := new(Manager)
 	m.initAntiflood()
+	m.privacyGuard, _ = NewPrivacyGuard(DefaultSensitiveURLPatterns)
+	m.httpClients, _ = httpclient.NewFactory(httpclient.DefaultConfig())
 	return m
 }
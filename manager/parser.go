@@ -6,13 +6,18 @@ import (
 	"log"
 	"net/url"
 	"reflect"
+	"sync/atomic"
 
 	"github.com/icedream/irc-medialink/parsers"
+	"github.com/icedream/irc-medialink/util/httpclient"
 )
 
 // ErrAlreadyLoaded is returned when a parser attempting to register is already found to be loaded with the same ID.
 var ErrAlreadyLoaded = errors.New("already loaded")
 
+// ErrShuttingDown is returned when a URL is to be parsed after Shutdown has been called.
+var ErrShuttingDown = errors.New("shutting down")
+
 // Parser describes the core functionality of any parser used to analyze URLs.
 type Parser interface {
 	Init(ctx context.Context) error
@@ -20,6 +25,35 @@ type Parser interface {
 	Parse(ctx context.Context, u *url.URL, referer *url.URL) parsers.ParseResult
 }
 
+// Searcher is implemented by parsers that can also look up content by a
+// search query.
+type Searcher interface {
+	Parser
+	Search(ctx context.Context, query string) parsers.ParseResult
+}
+
+// ShutdownParser is implemented by parsers that need to release resources
+// when the bot shuts down.
+type ShutdownParser interface {
+	Parser
+	Shutdown(ctx context.Context) error
+}
+
+// HTTPParser is implemented by parsers that make HTTP requests. They are
+// given the manager's HTTP client factory before they are initialized.
+type HTTPParser interface {
+	Parser
+	SetHTTPClientFactory(f *httpclient.Factory)
+}
+
+// SetHTTPClientFactory replaces the factory of the HTTP clients handed to
+// parsers registered afterwards.
+func (m *Manager) SetHTTPClientFactory(f *httpclient.Factory) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	m.httpClients = f
+}
+
 // GetParsers returns a slice of currently loaded parsers.
 func (m *Manager) GetParsers() []Parser {
 	m.stateLock.RLock()
@@ -44,6 +78,9 @@ func (m *Manager) RegisterParser(ctx context.Context, parser Parser) error {
 	}
 
 	// Initialize parser
+	if hp, ok := parser.(HTTPParser); ok {
+		hp.SetHTTPClientFactory(m.httpClients)
+	}
 	log.Printf("Initializing %s parser...", parser.Name())
 	if err := parser.Init(ctx); err != nil {
 		return err
@@ -55,18 +92,52 @@ func (m *Manager) RegisterParser(ctx context.Context, parser Parser) error {
 	return nil
 }
 
+// ParserFilter decides whether a parser may be used for parsing a URL.
+type ParserFilter func(p Parser) bool
+
+// URLFilter decides whether a URL may be parsed, including URLs parsers
+// redirect to.
+type URLFilter func(u *url.URL) bool
+
 // Parse goes through all loaded parsers in order to analyze a given URL.
 func (m *Manager) Parse(ctx context.Context, currentURL *url.URL) (string, parsers.ParseResult) {
+	return m.ParseWithFilter(ctx, currentURL, nil, nil)
+}
+
+// ParseWithFilter goes through all loaded parsers accepted by the given
+// filter in order to analyze a given URL. Parsing stops as soon as the URL or
+// a URL a parser redirects to is not accepted by urlFilter. Nil filters
+// accept everything.
+func (m *Manager) ParseWithFilter(ctx context.Context, currentURL *url.URL, urlFilter URLFilter, filter ParserFilter) (string, parsers.ParseResult) {
+	if !m.startParse() {
+		return "", parsers.ParseResult{Error: ErrShuttingDown}
+	}
+	defer m.runningParses.Done()
+
+	guard := m.PrivacyGuard()
 	var referer *url.URL
 	attempt := 0
 followLoop:
 	for currentURL != nil {
 		attempt++
 		if attempt > 15 {
-			log.Printf("WARNING: Potential infinite loop for url %s, abort parsing", currentURL)
+			log.Printf("WARNING: Potential infinite loop for url %s, abort parsing", guard.RedactURL(currentURL))
 			break
 		}
+		if guard.IsSensitive(currentURL) {
+			log.Printf("WARNING: Not parsing sensitive URL %s", guard.RedactURL(currentURL))
+			atomic.AddUint64(&m.stats.ignored, 1)
+			return "", parsers.ParseResult{Error: ErrSensitiveURL}
+		}
+		if urlFilter != nil && !urlFilter(currentURL) {
+			log.Printf("Not parsing filtered URL %s", guard.RedactURL(currentURL))
+			atomic.AddUint64(&m.stats.ignored, 1)
+			return "", parsers.ParseResult{Ignored: true}
+		}
 		for _, p := range m.GetParsers() {
+			if filter != nil && !filter(p) {
+				continue
+			}
 			var refererCopy *url.URL
 			if referer != nil {
 				refererCopy = &url.URL{}
@@ -86,18 +157,81 @@ followLoop:
 				}
 				referer = currentURL
 				currentURL = r.FollowURL
-				log.Printf("Redirect %s => %s", referer.String(), currentURL.String())
+				log.Printf("Redirect %s => %s", guard.RedactURL(referer), guard.RedactURL(currentURL))
 				continue followLoop
 			}
-			log.Printf("Parser match %s - %s %+v", currentURL.String(), p.Name(), r)
+			log.Printf("Parser match %s - %s %+v", guard.RedactURL(currentURL), p.Name(), r)
+			if r.Error != nil || r.UserError != nil {
+				atomic.AddUint64(&m.stats.errors, 1)
+			} else {
+				atomic.AddUint64(&m.stats.parsed, 1)
+			}
 			return p.Name(), r
 		}
 		currentURL = nil
 	}
 
 	// No parser matches, link ignored
-	log.Printf("No parser match %s", currentURL)
+	log.Printf("No parser match %s", guard.RedactURL(currentURL))
+	atomic.AddUint64(&m.stats.ignored, 1)
 	return "", parsers.ParseResult{
 		Ignored: true,
 	}
 }
+
+// Search looks up content using the given parser. Like parsing, searching is
+// not possible anymore once Shutdown has been called.
+func (m *Manager) Search(ctx context.Context, s Searcher, query string) parsers.ParseResult {
+	if !m.startParse() {
+		return parsers.ParseResult{Error: ErrShuttingDown}
+	}
+	defer m.runningParses.Done()
+
+	return s.Search(ctx, query)
+}
+
+// startParse registers a running parse unless we are shutting down.
+func (m *Manager) startParse() bool {
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+	if m.shuttingDown {
+		return false
+	}
+	m.runningParses.Add(1)
+	return true
+}
+
+// Shutdown waits for running parses to finish and then shuts down all
+// parsers that support it. If the context is done before, parsers are shut
+// down right away.
+func (m *Manager) Shutdown(ctx context.Context) (err error) {
+	m.stateLock.Lock()
+	m.shuttingDown = true
+	m.stateLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.runningParses.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	for _, p := range m.GetParsers() {
+		if sp, ok := p.(ShutdownParser); ok {
+			log.Printf("Shutting down %s parser...", p.Name())
+			if shutdownErr := sp.Shutdown(ctx); shutdownErr != nil {
+				log.Printf("WARNING: Could not shut down %s parser: %s", p.Name(), shutdownErr.Error())
+			}
+		}
+	}
+
+	m.stateLock.RLock()
+	m.httpClients.CloseIdleConnections()
+	m.stateLock.RUnlock()
+
+	return
+}
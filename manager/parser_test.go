@@ -0,0 +1,132 @@
+package manager_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/icedream/irc-medialink/manager"
+	"github.com/icedream/irc-medialink/parsers"
+	"github.com/icedream/irc-medialink/util/httpclient"
+)
+
+type slowParser struct {
+	started  chan struct{}
+	release  chan struct{}
+	shutdown bool
+}
+
+func (p *slowParser) Init(ctx context.Context) error { return nil }
+
+func (p *slowParser) Name() string { return "Slow" }
+
+func (p *slowParser) Parse(ctx context.Context, u *url.URL, referer *url.URL) parsers.ParseResult {
+	close(p.started)
+	<-p.release
+	return parsers.ParseResult{Information: []map[string]interface{}{{"Title": "Slow"}}}
+}
+
+func (p *slowParser) Shutdown(ctx context.Context) error {
+	p.shutdown = true
+	return nil
+}
+
+func TestManager_Shutdown(t *testing.T) {
+	m := manager.NewManager()
+	p := &slowParser{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	require.NoError(t, m.RegisterParser(context.Background(), p))
+
+	u := &url.URL{Scheme: "https", Host: "example.com", Path: "/"}
+	parsed := make(chan parsers.ParseResult)
+	go func() {
+		_, result := m.Parse(context.Background(), u)
+		parsed <- result
+	}()
+	<-p.started
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- m.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-shutdownDone:
+		t.Fatal("Shutdown returned while a link was still being parsed")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(p.release)
+	assert.NotEmpty(t, (<-parsed).Information)
+	require.NoError(t, <-shutdownDone)
+	assert.True(t, p.shutdown)
+
+	_, result := m.Parse(context.Background(), u)
+	assert.ErrorIs(t, result.Error, manager.ErrShuttingDown)
+}
+
+type httpParser struct {
+	factory *httpclient.Factory
+	inited  bool
+}
+
+func (p *httpParser) Init(ctx context.Context) error {
+	p.inited = p.factory != nil
+	return nil
+}
+
+func (p *httpParser) Name() string { return "HTTP" }
+
+func (p *httpParser) Parse(ctx context.Context, u *url.URL, referer *url.URL) parsers.ParseResult {
+	return parsers.ParseResult{Ignored: true}
+}
+
+func (p *httpParser) SetHTTPClientFactory(f *httpclient.Factory) {
+	p.factory = f
+}
+
+func TestManager_RegisterParser_HTTPClientFactory(t *testing.T) {
+	f, err := httpclient.NewFactory(httpclient.DefaultConfig())
+	require.NoError(t, err)
+
+	m := manager.NewManager()
+	m.SetHTTPClientFactory(f)
+	p := &httpParser{}
+	require.NoError(t, m.RegisterParser(context.Background(), p))
+	assert.Same(t, f, p.factory)
+	assert.True(t, p.inited, "factory must be set before initializing the parser")
+}
+
+func TestManager_ParseWithFilter_Redirect(t *testing.T) {
+	m := manager.NewManager()
+	p := &redirectParser{
+		target: mustParseURL(t, "https://denied.example.net/"),
+	}
+	require.NoError(t, m.RegisterParser(context.Background(), p))
+
+	allowURL := func(u *url.URL) bool {
+		return u.Hostname() != "denied.example.net"
+	}
+
+	// URLs parsers redirect to are checked as well
+	_, result := m.ParseWithFilter(context.Background(), mustParseURL(t, "https://example.com/"), allowURL, nil)
+	assert.True(t, result.Ignored)
+	assert.Empty(t, result.Information)
+	assert.Equal(t, []string{"https://example.com/"}, p.parsed)
+
+	p.parsed = nil
+	_, result = m.ParseWithFilter(context.Background(), mustParseURL(t, "https://denied.example.net/"), allowURL, nil)
+	assert.True(t, result.Ignored)
+	assert.Empty(t, p.parsed)
+
+	p.target = mustParseURL(t, "https://allowed.example.net/")
+	_, result = m.ParseWithFilter(context.Background(), mustParseURL(t, "https://example.com/"), allowURL, nil)
+	assert.False(t, result.Ignored)
+	assert.NotEmpty(t, result.Information)
+}
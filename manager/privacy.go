@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"mvdan.cc/xurls"
+)
+
+// ErrSensitiveURL is returned when a URL is not parsed since it seems to
+// contain credentials or tokens.
+var ErrSensitiveURL = errors.New("refusing to fetch URL with sensitive information")
+
+// DefaultSensitiveURLPatterns contains the patterns of URLs that are usually
+// only meant for a single person, such as signed download links and links
+// containing access tokens.
+var DefaultSensitiveURLPatterns = []string{
+	// Signed Amazon S3, Google Cloud Storage and Azure Storage URLs
+	`[?&#](x-amz-signature|x-amz-credential|x-amz-security-token|x-goog-signature|x-goog-credential|signature|sig)=`,
+	// Tokens, keys and passwords in the query string or fragment
+	`[?&#][\w.-]*(token|secret|password|passwd|api_?key|access_?key|session_?id|auth)=`,
+	// Password reset and login links
+	`/(password[-_]?reset|reset[-_]?password|forgot[-_]?password|magic[-_]?link)\b`,
+}
+
+// PrivacyGuard decides which URLs are too sensitive to be fetched or logged.
+type PrivacyGuard struct {
+	patterns []*regexp.Regexp
+}
+
+// NewPrivacyGuard creates a privacy guard that treats URLs as sensitive if
+// they contain credentials or match any of the given regular expressions.
+// Patterns are matched case-insensitively against the whole URL.
+func NewPrivacyGuard(patterns []string) (*PrivacyGuard, error) {
+	g := &PrivacyGuard{}
+	for _, pattern := range patterns {
+		rx, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		g.patterns = append(g.patterns, rx)
+	}
+	return g, nil
+}
+
+// IsSensitive checks whether the given URL must neither be fetched nor
+// logged.
+func (g *PrivacyGuard) IsSensitive(u *url.URL) bool {
+	if u.User != nil {
+		return true
+	}
+	s := u.String()
+	for _, rx := range g.patterns {
+		if rx.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactURL returns the URL for logging, leaving out everything but the
+// scheme and host if it is sensitive.
+func (g *PrivacyGuard) RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if !g.IsSensitive(u) {
+		return u.String()
+	}
+	return redactedURL(u)
+}
+
+// RedactText replaces sensitive URLs in the given text, for example a chat
+// message, for logging.
+func (g *PrivacyGuard) RedactText(text string) string {
+	result := &strings.Builder{}
+	last := 0
+	for _, loc := range xurls.Relaxed.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if start > 0 && text[start-1] == '@' {
+			// Credentials in front of a link without a scheme are not
+			// matched, while e-mail addresses are fine to keep
+			userinfoStart := strings.LastIndexAny(text[:start-1], " \t") + 1
+			if userinfoStart < last || !strings.ContainsRune(text[userinfoStart:start], ':') {
+				continue
+			}
+			start = userinfoStart
+		}
+		link := text[start:end]
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		if err == nil && !g.IsSensitive(u) {
+			continue
+		}
+		result.WriteString(text[last:start])
+		if err != nil {
+			// We can't tell what's in there, so leave out all of it
+			result.WriteString("[redacted]")
+		} else {
+			result.WriteString(redactedURL(u))
+		}
+		last = end
+	}
+	result.WriteString(text[last:])
+	return result.String()
+}
+
+func redactedURL(u *url.URL) string {
+	redacted := &url.URL{Scheme: u.Scheme, Host: u.Host}
+	return redacted.String() + "/[redacted]"
+}
+
+// SetPrivacyGuard replaces the privacy guard used to decide which URLs are
+// not fetched, including URLs parsers redirect to.
+func (m *Manager) SetPrivacyGuard(g *PrivacyGuard) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	m.privacyGuard = g
+}
+
+// PrivacyGuard returns the privacy guard in use.
+func (m *Manager) PrivacyGuard() *PrivacyGuard {
+	m.stateLock.RLock()
+	defer m.stateLock.RUnlock()
+	return m.privacyGuard
+}
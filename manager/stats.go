@@ -0,0 +1,28 @@
+package manager
+
+import "sync/atomic"
+
+// Stats contains counters about the work done by the manager.
+type Stats struct {
+	// Parsed is the number of URLs a parser returned information for.
+	Parsed uint64
+	// Ignored is the number of URLs no parser could handle.
+	Ignored uint64
+	// Errors is the number of URLs that resulted in an error.
+	Errors uint64
+}
+
+type statsCounters struct {
+	parsed  uint64
+	ignored uint64
+	errors  uint64
+}
+
+// Stats returns a snapshot of the manager's counters.
+func (m *Manager) Stats() Stats {
+	return Stats{
+		Parsed:  atomic.LoadUint64(&m.stats.parsed),
+		Ignored: atomic.LoadUint64(&m.stats.ignored),
+		Errors:  atomic.LoadUint64(&m.stats.errors),
+	}
+}
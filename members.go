@@ -0,0 +1,343 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// channelMember contains what we know about a user in a channel.
+type channelMember struct {
+	Nick string
+	User string
+	Host string
+
+	// Modes contains the channel privilege modes (such as "o" or "v") of this
+	// member, ordered from highest to lowest privilege.
+	Modes string
+
+	// IsBot is set if the server marks this user as a bot.
+	IsBot bool
+
+	// Account is the services account of this member, empty if they are not
+	// logged in. It is only valid if AccountKnown is set.
+	Account      string
+	AccountKnown bool
+}
+
+// Source returns the nick!user@host mask of this member, or just the
+// nickname if the rest is unknown.
+func (member *channelMember) Source() string {
+	if len(member.User) == 0 || len(member.Host) == 0 {
+		return member.Nick
+	}
+	return member.Nick + "!" + member.User + "@" + member.Host
+}
+
+var (
+	channelMembers    = map[string]map[string]*channelMember{}
+	channelMemberLock sync.RWMutex
+)
+
+// sortPrefixModes orders the given privilege modes by the order given in the
+// server's PREFIX token.
+func sortPrefixModes(modes string) string {
+	prefixModes, _ := serverSupport.Prefixes()
+	rank := func(mode rune) int {
+		// Modes missing from PREFIX, for example after it changed, go last
+		if i := strings.IndexRune(prefixModes, mode); i >= 0 {
+			return i
+		}
+		return len(prefixModes)
+	}
+	runes := []rune(modes)
+	sort.SliceStable(runes, func(i, j int) bool {
+		return rank(runes[i]) < rank(runes[j])
+	})
+	return string(runes)
+}
+
+// parseNamesEntry splits up a single entry of a RPL_NAMREPLY into the
+// privilege modes and the nickname, user and host of the member. User and
+// host are only filled in if the server sends them (userhost-in-names).
+func parseNamesEntry(entry string) (modes, nick, user, host string) {
+	prefixModes, prefixSymbols := serverSupport.Prefixes()
+	for len(entry) > 0 {
+		i := strings.IndexByte(prefixSymbols, entry[0])
+		if i < 0 {
+			break
+		}
+		modes += string(prefixModes[i])
+		entry = entry[1:]
+	}
+
+	nick = entry
+	if i, j := strings.IndexRune(entry, '!'), strings.IndexRune(entry, '@'); i > -1 && j > -1 && i < j {
+		nick, user, host = entry[0:i], entry[i+1:j], entry[j+1:]
+	}
+	return
+}
+
+func addChannelMember(channel string, member channelMember) {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	channel = foldName(channel)
+
+	members, ok := channelMembers[channel]
+	if !ok {
+		members = map[string]*channelMember{}
+		channelMembers[channel] = members
+	}
+
+	member.Modes = sortPrefixModes(member.Modes)
+	if existing, ok := members[foldName(member.Nick)]; ok {
+		// Keep details we already know about
+		if len(member.User) == 0 {
+			member.User = existing.User
+		}
+		if len(member.Host) == 0 {
+			member.Host = existing.Host
+		}
+		member.IsBot = member.IsBot || existing.IsBot
+		if !member.AccountKnown {
+			member.Account = existing.Account
+			member.AccountKnown = existing.AccountKnown
+		}
+	}
+	members[foldName(member.Nick)] = &member
+}
+
+// updateUserDetails remembers user, host and bot status of the given
+// nickname in all channels we share with them.
+func updateUserDetails(nick, user, host string, isBot bool) {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	nick = foldName(nick)
+
+	for _, members := range channelMembers {
+		if member, ok := members[nick]; ok {
+			if len(user) > 0 && len(host) > 0 {
+				member.User = user
+				member.Host = host
+			}
+			member.IsBot = isBot
+		}
+	}
+}
+
+// setUserAccount remembers the services account of the given nickname in all
+// channels we share with them. An empty account means they are not logged
+// in.
+func setUserAccount(nick, account string) {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	nick = foldName(nick)
+
+	for _, members := range channelMembers {
+		if member, ok := members[nick]; ok {
+			member.Account = account
+			member.AccountKnown = true
+		}
+	}
+}
+
+// getUserAccount returns the services account of the given nickname if we
+// know it from any of the channels we share with them.
+func getUserAccount(nick string) (account string, ok bool) {
+	channelMemberLock.RLock()
+	defer channelMemberLock.RUnlock()
+	nick = foldName(nick)
+
+	for _, members := range channelMembers {
+		if member, exists := members[nick]; exists && member.AccountKnown {
+			return member.Account, true
+		}
+	}
+	return "", false
+}
+
+// parseAccountName converts an account name as sent by the server in
+// extended JOIN and ACCOUNT messages to an empty string if the user is not
+// logged in.
+func parseAccountName(account string) string {
+	if account == "*" {
+		return ""
+	}
+	return account
+}
+
+// parseWhoFlags checks the flags of a RPL_WHOREPLY for the bot mode as
+// advertised via the BOT token.
+func parseWhoFlags(flags string) (isBot bool) {
+	botMode, ok := serverSupport.Token("BOT")
+	return ok && len(botMode) > 0 && strings.Contains(flags, botMode)
+}
+
+// isKnownBot checks whether the server marked the given nickname as a bot in
+// any of the channels we share with them.
+func isKnownBot(nick string) bool {
+	channelMemberLock.RLock()
+	defer channelMemberLock.RUnlock()
+	nick = foldName(nick)
+
+	for _, members := range channelMembers {
+		if member, ok := members[nick]; ok && member.IsBot {
+			return true
+		}
+	}
+	return false
+}
+
+func removeChannelMember(channel, nick string) {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	channel = foldName(channel)
+
+	if members, ok := channelMembers[channel]; ok {
+		delete(members, foldName(nick))
+	}
+}
+
+// removeUserFromAllChannels removes the given nickname from all channels,
+// returning the names of the channels they have been removed from.
+func removeUserFromAllChannels(nick string) (channels []string) {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	nick = foldName(nick)
+
+	for channel, members := range channelMembers {
+		if _, ok := members[nick]; ok {
+			delete(members, nick)
+			channels = append(channels, channel)
+		}
+	}
+	return
+}
+
+// renameChannelMember handles nickname changes of a user in all channels.
+func renameChannelMember(oldNick, newNick string) {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	oldNick = foldName(oldNick)
+
+	for _, members := range channelMembers {
+		if member, ok := members[oldNick]; ok {
+			delete(members, oldNick)
+			member.Nick = newNick
+			members[foldName(newNick)] = member
+		}
+	}
+}
+
+func setChannelMemberMode(channel, nick string, mode rune, add bool) {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	channel = foldName(channel)
+
+	members, ok := channelMembers[channel]
+	if !ok {
+		return
+	}
+	member, ok := members[foldName(nick)]
+	if !ok {
+		return
+	}
+
+	index := strings.IndexRune(member.Modes, mode)
+	switch {
+	case add && index < 0:
+		member.Modes = sortPrefixModes(member.Modes + string(mode))
+	case !add && index >= 0:
+		member.Modes = member.Modes[0:index] + member.Modes[index+1:]
+	}
+}
+
+func deleteChannelMembers(channel string) {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	delete(channelMembers, foldName(channel))
+}
+
+func resetAllChannelMembers() {
+	channelMemberLock.Lock()
+	defer channelMemberLock.Unlock()
+	channelMembers = map[string]map[string]*channelMember{}
+}
+
+// getChannelMember returns a copy of what we know about the given nickname
+// in the given channel.
+func getChannelMember(channel, nick string) (member channelMember, ok bool) {
+	channelMemberLock.RLock()
+	defer channelMemberLock.RUnlock()
+
+	members, exists := channelMembers[foldName(channel)]
+	if !exists {
+		return
+	}
+	memberPtr, exists := members[foldName(nick)]
+	if !exists {
+		return
+	}
+	return *memberPtr, true
+}
+
+// getChannelMembers returns a copy of all known members of the given channel.
+func getChannelMembers(channel string) (result []channelMember) {
+	channelMemberLock.RLock()
+	defer channelMemberLock.RUnlock()
+
+	members := channelMembers[foldName(channel)]
+	result = make([]channelMember, 0, len(members))
+	for _, member := range members {
+		result = append(result, *member)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return foldName(result[i].Nick) < foldName(result[j].Nick)
+	})
+	return
+}
+
+// getUserChannels returns the names of all channels we share with the given
+// nickname.
+func getUserChannels(nick string) (channels []string) {
+	channelMemberLock.RLock()
+	defer channelMemberLock.RUnlock()
+	nick = foldName(nick)
+
+	for channel, members := range channelMembers {
+		if _, ok := members[nick]; ok {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return
+}
+
+// channelMemberHasPrivilege checks whether the given nickname has at least
+// the privilege of the given prefix mode in the given channel. If the server
+// does not know the given mode, only the exact mode is checked for.
+func channelMemberHasPrivilege(channel, nick string, minimumMode rune) bool {
+	member, ok := getChannelMember(channel, nick)
+	if !ok || len(member.Modes) == 0 {
+		return false
+	}
+
+	prefixModes, _ := serverSupport.Prefixes()
+	minimumIndex := strings.IndexRune(prefixModes, minimumMode)
+	if minimumIndex < 0 {
+		return strings.ContainsRune(member.Modes, minimumMode)
+	}
+
+	for _, mode := range member.Modes {
+		if index := strings.IndexRune(prefixModes, mode); index >= 0 && index <= minimumIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// isChannelOperator checks whether the given nickname is a channel operator
+// (or higher) in the given channel.
+func isChannelOperator(channel, nick string) bool {
+	return channelMemberHasPrivilege(channel, nick, 'o')
+}
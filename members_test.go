@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseNamesEntry(t *testing.T) {
+	serverSupport.Reset()
+	defer serverSupport.Reset()
+	serverSupport.Parse([]string{"PREFIX=(qaohv)~&@%+"})
+
+	modes, nick, user, host := parseNamesEntry("@+Icedream")
+	assert.Equal(t, "ov", modes)
+	assert.Equal(t, "Icedream", nick)
+	assert.Empty(t, user)
+	assert.Empty(t, host)
+
+	modes, nick, user, host = parseNamesEntry("~someone!ident@example.com")
+	assert.Equal(t, "q", modes)
+	assert.Equal(t, "someone", nick)
+	assert.Equal(t, "ident", user)
+	assert.Equal(t, "example.com", host)
+}
+
+func Test_ChannelMembers(t *testing.T) {
+	serverSupport.Reset()
+	defer serverSupport.Reset()
+	defer resetAllChannelMembers()
+	serverSupport.Parse([]string{"PREFIX=(qaohv)~&@%+"})
+
+	addChannelMember("#Test", channelMember{Nick: "Owner", Modes: "vq"})
+	addChannelMember("#test", channelMember{Nick: "HalfOp", Modes: "h"})
+	addChannelMember("#test", channelMember{Nick: "User", User: "ident", Host: "example.com"})
+
+	member, ok := getChannelMember("#TEST", "owner")
+	require.True(t, ok)
+	assert.Equal(t, "qv", member.Modes)
+	assert.True(t, isChannelOperator("#test", "Owner"))
+	assert.False(t, isChannelOperator("#test", "HalfOp"))
+	assert.True(t, channelMemberHasPrivilege("#test", "HalfOp", 'h'))
+	assert.Equal(t, "ovY", sortPrefixModes("vYo"))
+	addChannelMember("#test", channelMember{Nick: "Unknown", Modes: "Yo"})
+	assert.True(t, isChannelOperator("#test", "Unknown"))
+	removeChannelMember("#test", "Unknown")
+	assert.False(t, isChannelOperator("#test", "User"))
+
+	setChannelMemberMode("#test", "user", 'o', true)
+	assert.True(t, isChannelOperator("#test", "User"))
+	setChannelMemberMode("#test", "user", 'o', false)
+	assert.False(t, isChannelOperator("#test", "User"))
+
+	renameChannelMember("User", "User2")
+	_, ok = getChannelMember("#test", "User")
+	assert.False(t, ok)
+	member, ok = getChannelMember("#test", "User2")
+	require.True(t, ok)
+	assert.Equal(t, "User2!ident@example.com", member.Source())
+
+	assert.Equal(t, []string{"#test"}, getUserChannels("user2"))
+	assert.Equal(t, []string{"#test"}, removeUserFromAllChannels("user2"))
+	assert.Len(t, getChannelMembers("#test"), 2)
+
+	removeChannelMember("#test", "halfop")
+	assert.Len(t, getChannelMembers("#test"), 1)
+	deleteChannelMembers("#test")
+	assert.Empty(t, getChannelMembers("#test"))
+}
+
+func Test_UserAccount(t *testing.T) {
+	defer resetAllChannelMembers()
+
+	addChannelMember("#a", channelMember{Nick: "User"})
+	addChannelMember("#b", channelMember{Nick: "User", Account: "account", AccountKnown: true})
+	addChannelMember("#c", channelMember{Nick: "Other"})
+
+	account, ok := getUserAccount("user")
+	require.True(t, ok)
+	assert.Equal(t, "account", account)
+	_, ok = getUserAccount("Other")
+	assert.False(t, ok)
+
+	// Members joining again keep what we know about them
+	addChannelMember("#b", channelMember{Nick: "User", Modes: "v"})
+	member, _ := getChannelMember("#b", "User")
+	assert.Equal(t, "account", member.Account)
+
+	setUserAccount("User", parseAccountName("*"))
+	account, ok = getUserAccount("User")
+	require.True(t, ok)
+	assert.Empty(t, account)
+	member, _ = getChannelMember("#a", "User")
+	assert.True(t, member.AccountKnown)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// netsplitMemory is how long we remember users that got split off. Users
+// rejoining within that time are not treated as new joiners.
+const netsplitMemory = 30 * time.Minute
+
+// rxNetsplitServer matches a server name as given in netsplit quit messages.
+// Some networks hide the actual server names behind masks like "*.net".
+var rxNetsplitServer = regexp.MustCompile(`^[\w*-]+(\.[\w*-]+)+$`)
+
+// isNetsplitQuit checks whether the given quit message is the one servers
+// generate for users lost in a netsplit, consisting of the names of the two
+// servers that split.
+func isNetsplitQuit(message string) bool {
+	servers := strings.Split(message, " ")
+	return len(servers) == 2 &&
+		servers[0] != servers[1] &&
+		rxNetsplitServer.MatchString(servers[0]) &&
+		rxNetsplitServer.MatchString(servers[1])
+}
+
+// netsplitTracker remembers users that got lost in a netsplit so we can
+// recognize them when they come back. It is safe for concurrent use.
+type netsplitTracker struct {
+	lock  sync.Mutex
+	users map[string]time.Time
+	now   func() time.Time
+}
+
+func newNetsplitTracker() *netsplitTracker {
+	return &netsplitTracker{
+		users: map[string]time.Time{},
+		now:   time.Now,
+	}
+}
+
+// Split remembers that the user with the given source got lost in a
+// netsplit.
+func (t *netsplitTracker) Split(source string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	for user, splitAt := range t.users {
+		if now.Sub(splitAt) > netsplitMemory {
+			delete(t.users, user)
+		}
+	}
+	t.users[foldName(source)] = now
+}
+
+// IsReturning checks whether the user with the given source got lost in a
+// netsplit recently. Users may rejoin several channels, so they are only
+// forgotten once netsplitMemory passed.
+func (t *netsplitTracker) IsReturning(source string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	splitAt, ok := t.users[foldName(source)]
+	return ok && t.now().Sub(splitAt) <= netsplitMemory
+}
+
+// Reset forgets all users, for example when we got disconnected.
+func (t *netsplitTracker) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.users = map[string]time.Time{}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IsNetsplitQuit(t *testing.T) {
+	assert.True(t, isNetsplitQuit("irc.example.net hub.example.net"))
+	assert.True(t, isNetsplitQuit("*.net *.split"))
+	assert.False(t, isNetsplitQuit("irc.example.net irc.example.net"))
+	assert.False(t, isNetsplitQuit("Quit: leaving"))
+	assert.False(t, isNetsplitQuit("see main.go"))
+	assert.False(t, isNetsplitQuit("Ping timeout: 240 seconds"))
+	assert.False(t, isNetsplitQuit("a.b c.d e.f"))
+}
+
+func Test_NetsplitTracker(t *testing.T) {
+	now := time.Now()
+	splits := newNetsplitTracker()
+	splits.now = func() time.Time { return now }
+
+	splits.Split("User!ident@example.com")
+	assert.True(t, splits.IsReturning("user!ident@example.com"))
+	assert.True(t, splits.IsReturning("user!ident@example.com"), "users may rejoin several channels")
+	assert.False(t, splits.IsReturning("Other!ident@example.com"))
+
+	now = now.Add(netsplitMemory + time.Second)
+	assert.False(t, splits.IsReturning("user!ident@example.com"))
+
+	splits.Split("Other!ident@example.com")
+	assert.Len(t, splits.users, 1, "expired users should be cleaned up")
+
+	splits.Reset()
+	assert.False(t, splits.IsReturning("Other!ident@example.com"))
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Ways of asking services to release our nickname
+const (
+	nickRegainNone   = "none"
+	nickRegainGhost  = "ghost"
+	nickRegainRegain = "regain"
+)
+
+// nickConn describes the methods of the IRC connection that nickKeeper
+// needs.
+type nickConn interface {
+	Privmsg(target, message string)
+	SendRawf(format string, a ...interface{})
+}
+
+// nickKeeper keeps track of the nickname we are currently using and tries to
+// get back the configured one if we had to use another nickname.
+//
+// If we know the services password, services are asked to release the
+// nickname. Otherwise we wait for the nickname to become free, using MONITOR
+// if the server supports it or periodic ISON queries.
+type nickKeeper struct {
+	lock sync.Mutex
+	conn nickConn
+
+	wanted     string
+	current    string
+	registered bool
+
+	// ServicesPassword and ServicesMethod are used to ask NickServ to
+	// release the nickname.
+	ServicesPassword string
+	ServicesMethod   string
+	// PollInterval is the interval of ISON queries if the server does not
+	// support MONITOR, zero disables polling.
+	PollInterval time.Duration
+
+	monitoring  bool
+	stopPolling chan struct{}
+}
+
+func newNickKeeper(conn nickConn, wanted string) *nickKeeper {
+	return &nickKeeper{
+		conn:           conn,
+		wanted:         wanted,
+		current:        wanted,
+		ServicesMethod: nickRegainNone,
+	}
+}
+
+// Current returns the nickname we are currently using.
+func (k *nickKeeper) Current() string {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.current
+}
+
+// Wanted returns the configured nickname.
+func (k *nickKeeper) Wanted() string {
+	return k.wanted
+}
+
+// Registered is called when the server accepted our connection using the
+// given nickname.
+func (k *nickKeeper) Registered(nick string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.current = nick
+	k.registered = true
+	if isSameName(k.current, k.wanted) || len(k.ServicesPassword) == 0 {
+		return
+	}
+
+	switch k.ServicesMethod {
+	case nickRegainRegain:
+		// Services change our nickname by themselves
+		k.conn.Privmsg("NickServ", fmt.Sprintf("REGAIN %s %s", k.wanted, k.ServicesPassword))
+	case nickRegainGhost:
+		// Services disconnect whoever uses the nickname, we will notice it
+		// being free once we are watching it
+		k.conn.Privmsg("NickServ", fmt.Sprintf("GHOST %s %s", k.wanted, k.ServicesPassword))
+	}
+}
+
+// StartWatching is called once the server told us about its features to wait
+// for the configured nickname to become free if we do not have it.
+func (k *nickKeeper) StartWatching() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if !k.registered || isSameName(k.current, k.wanted) || k.monitoring || k.stopPolling != nil {
+		return
+	}
+
+	if _, ok := serverSupport.Token("MONITOR"); ok {
+		k.conn.SendRawf("MONITOR + %s", k.wanted)
+		k.monitoring = true
+		return
+	}
+
+	if k.PollInterval > 0 {
+		k.stopPolling = make(chan struct{})
+		go k.poll(k.stopPolling)
+	}
+}
+
+func (k *nickKeeper) poll(stop chan struct{}) {
+	ticker := time.NewTicker(k.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			k.conn.SendRawf("ISON %s", k.wanted)
+		}
+	}
+}
+
+// stopWatching stops waiting for the nickname. The lock must be held by the
+// caller.
+func (k *nickKeeper) stopWatching() {
+	if k.monitoring {
+		k.conn.SendRawf("MONITOR - %s", k.wanted)
+		k.monitoring = false
+	}
+	if k.stopPolling != nil {
+		close(k.stopPolling)
+		k.stopPolling = nil
+	}
+}
+
+// Disconnected is called when we lost the connection to the server.
+func (k *nickKeeper) Disconnected() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	// MONITOR entries are gone along with the connection
+	k.monitoring = false
+	k.stopWatching()
+	k.registered = false
+	k.current = k.wanted
+}
+
+// tryWanted switches to the configured nickname if we are not using it. The
+// lock must be held by the caller.
+func (k *nickKeeper) tryWanted() {
+	if !k.registered || isSameName(k.current, k.wanted) {
+		return
+	}
+	k.conn.SendRawf("NICK %s", k.wanted)
+}
+
+// NickChanged handles a user changing their nickname.
+func (k *nickKeeper) NickChanged(oldNick, newNick string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	switch {
+	case isSameName(oldNick, k.current):
+		k.current = newNick
+		if isSameName(newNick, k.wanted) {
+			k.stopWatching()
+		}
+	case isSameName(oldNick, k.wanted):
+		// Whoever used our nickname just gave it up
+		k.tryWanted()
+	}
+}
+
+// UserQuit handles a user disconnecting.
+func (k *nickKeeper) UserQuit(nick string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if isSameName(nick, k.wanted) {
+		k.tryWanted()
+	}
+}
+
+// MonitorOffline handles RPL_MONOFFLINE with the given nicknames.
+func (k *nickKeeper) MonitorOffline(nicks []string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	for _, nick := range nicks {
+		if isSameName(nick, k.wanted) {
+			k.tryWanted()
+			return
+		}
+	}
+}
+
+// IsOnReply handles RPL_ISON with the given nicknames that are online.
+func (k *nickKeeper) IsOnReply(nicks []string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	for _, nick := range nicks {
+		if isSameName(nick, k.wanted) {
+			return
+		}
+	}
+	k.tryWanted()
+}
+
+// NickUnavailable handles the server rejecting a nickname we tried to use.
+func (k *nickKeeper) NickUnavailable() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	// Once registered, we just keep our current nickname and try again later
+	if k.registered {
+		return
+	}
+
+	// Pick an alternative nickname to complete registration
+	if len(k.current) > 8 {
+		k.current = "_" + k.current
+	} else {
+		k.current = k.current + "_"
+	}
+	k.conn.SendRawf("NICK %s", k.current)
+}
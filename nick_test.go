@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testNickConn struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+func (c *testNickConn) Privmsg(target, message string) {
+	c.SendRawf("PRIVMSG %s :%s", target, message)
+}
+
+func (c *testNickConn) SendRawf(format string, a ...interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lines = append(c.lines, fmt.Sprintf(format, a...))
+}
+
+func (c *testNickConn) Lines() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	lines := c.lines
+	c.lines = nil
+	return lines
+}
+
+func Test_NickKeeper_Registration(t *testing.T) {
+	conn := &testNickConn{}
+	k := newNickKeeper(conn, "MediaLink")
+
+	k.NickUnavailable()
+	assert.Equal(t, []string{"NICK _MediaLink"}, conn.Lines())
+
+	k.Registered("_MediaLink")
+	assert.Equal(t, "_MediaLink", k.Current())
+	assert.Empty(t, conn.Lines())
+
+	// No more alternative nicknames after registration
+	k.NickUnavailable()
+	assert.Empty(t, conn.Lines())
+	assert.Equal(t, "_MediaLink", k.Current())
+}
+
+func Test_NickKeeper_Services(t *testing.T) {
+	conn := &testNickConn{}
+	k := newNickKeeper(conn, "Bot")
+	k.ServicesPassword = "secret"
+	k.ServicesMethod = nickRegainRegain
+
+	k.Registered("Bot_")
+	assert.Equal(t, []string{"PRIVMSG NickServ :REGAIN Bot secret"}, conn.Lines())
+
+	// Services changed our nickname
+	k.NickChanged("Bot_", "Bot")
+	assert.Equal(t, "Bot", k.Current())
+
+	k.Disconnected()
+	k.ServicesMethod = nickRegainGhost
+	k.Registered("Bot_")
+	assert.Equal(t, []string{"PRIVMSG NickServ :GHOST Bot secret"}, conn.Lines())
+
+	// Nothing to do with our nickname
+	k.Disconnected()
+	k.Registered("Bot")
+	assert.Empty(t, conn.Lines())
+}
+
+func Test_NickKeeper_Monitor(t *testing.T) {
+	serverSupport.Reset()
+	defer serverSupport.Reset()
+	serverSupport.Parse([]string{"MONITOR=100"})
+
+	conn := &testNickConn{}
+	k := newNickKeeper(conn, "Bot")
+	k.Registered("Bot_")
+	k.StartWatching()
+	assert.Equal(t, []string{"MONITOR + Bot"}, conn.Lines())
+
+	k.MonitorOffline([]string{"Someone", "bot"})
+	assert.Equal(t, []string{"NICK Bot"}, conn.Lines())
+
+	k.NickChanged("Bot_", "Bot")
+	assert.Equal(t, "Bot", k.Current())
+	assert.Equal(t, []string{"MONITOR - Bot"}, conn.Lines())
+}
+
+func Test_NickKeeper_IsOn(t *testing.T) {
+	serverSupport.Reset()
+
+	conn := &testNickConn{}
+	k := newNickKeeper(conn, "Bot")
+	k.Registered("Bot_")
+
+	k.IsOnReply([]string{"Bot"})
+	assert.Empty(t, conn.Lines())
+	k.IsOnReply([]string{})
+	assert.Equal(t, []string{"NICK Bot"}, conn.Lines())
+
+	// The user holding our nickname changes it or leaves
+	k.NickChanged("Bot", "Other")
+	assert.Equal(t, []string{"NICK Bot"}, conn.Lines())
+	k.UserQuit("Bot")
+	assert.Equal(t, []string{"NICK Bot"}, conn.Lines())
+
+	k.NickChanged("Bot_", "Bot")
+	k.UserQuit("Bot")
+	assert.Empty(t, conn.Lines())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// optOuts describes how users can keep us from previewing links.
+type optOuts struct {
+	// Markers keep us from previewing a link if they are put right in front
+	// of it, either directly or separated by a space.
+	Markers []string
+
+	// MessagePrefixes keep us from previewing any links in messages starting
+	// with one of them.
+	MessagePrefixes []string
+}
+
+// MessageOptedOut checks whether the message starts with one of the opt-out
+// prefixes.
+func (o *optOuts) MessageOptedOut(msg string) bool {
+	msg = strings.TrimLeftFunc(msg, unicode.IsSpace)
+	for _, prefix := range o.MessagePrefixes {
+		if len(prefix) > 0 && hasPrefixFold(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// URLOptedOut checks whether the link found at msg[start:end] has been
+// wrapped in angle brackets or marked with one of the opt-out markers.
+func (o *optOuts) URLOptedOut(msg string, start, end int) bool {
+	before, after := msg[:start], msg[end:]
+	if strings.HasSuffix(before, "<") && strings.HasPrefix(after, ">") {
+		return true
+	}
+
+	before = strings.TrimSuffix(before, " ")
+	for _, marker := range o.Markers {
+		if len(marker) == 0 || !hasSuffixFold(before, marker) {
+			continue
+		}
+		// Only count markers that are not just the end of another word
+		rest := before[:len(before)-len(marker)]
+		if len(rest) == 0 || strings.HasSuffix(rest, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
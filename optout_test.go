@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LinkFinder_OptOuts(t *testing.T) {
+	f := &linkFinder{
+		OptOuts: &optOuts{
+			Markers:         []string{"!", "nopreview"},
+			MessagePrefixes: []string{"[np]"},
+		},
+	}
+
+	// Wrapped in angle brackets
+	assert.Empty(t, f.Find("spoiler: <https://example.com>"))
+	assert.Equal(t, "https://example.org", f.Find("<https://example.com> https://example.org"))
+
+	// Markers
+	assert.Empty(t, f.Find("!https://example.com"))
+	assert.Empty(t, f.Find("look at ! https://example.com"))
+	assert.Empty(t, f.Find("NoPreview https://example.com"))
+	assert.Equal(t, "https://example.com", f.Find("wow!https://example.com"))
+	assert.Equal(t, "https://example.org", f.Find("!https://example.com or https://example.org"))
+
+	// Message prefixes
+	assert.Empty(t, f.Find("[NP] https://example.com"))
+	assert.Empty(t, f.Find("  [np] see https://example.com"))
+	assert.Equal(t, "https://example.com", f.Find("see https://example.com [np]"))
+
+	// Nothing configured
+	f.OptOuts = &optOuts{}
+	assert.Equal(t, "https://example.com", f.Find("!https://example.com"))
+}
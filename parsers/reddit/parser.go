@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"regexp"
 	"runtime"
@@ -12,6 +13,7 @@ import (
 	"github.com/vartanbeno/go-reddit/v2/reddit"
 
 	"github.com/icedream/irc-medialink/parsers"
+	"github.com/icedream/irc-medialink/util/httpclient"
 	"github.com/icedream/irc-medialink/version"
 )
 
@@ -24,9 +26,16 @@ var emptyURLValues = url.Values{}
 // Parser implements parsing for Reddit URLs.
 type Parser struct {
 	api    *reddit.Client
+	http   *http.Client
 	Config *Config
 }
 
+// SetHTTPClientFactory sets the factory of the HTTP client used for API
+// requests.
+func (p *Parser) SetHTTPClientFactory(f *httpclient.Factory) {
+	p.http = f.Client()
+}
+
 // Init initializes this parser.
 func (p *Parser) Init(_ context.Context) error {
 	// <platform>:<app ID>:<version string> (by /u/<reddit username>)
@@ -47,6 +56,9 @@ func (p *Parser) Init(_ context.Context) error {
 		reddit.WithUserAgent(userAgent),
 		reddit.WithApplicationOnlyOAuth(true),
 	}
+	if p.http != nil {
+		opts = append(opts, reddit.WithHTTPClient(p.http))
+	}
 
 	if creds != nil {
 		log.Println("Using reddit credentials")
@@ -2,6 +2,7 @@ package soundcloud
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"github.com/yanatan16/golang-soundcloud/soundcloud"
 
 	"github.com/icedream/irc-medialink/parsers"
+	"github.com/icedream/irc-medialink/util/httpclient"
 )
 
 const (
@@ -20,6 +22,9 @@ const (
 
 var emptyURLValues = url.Values{}
 
+// ErrNotFound is returned when a search yields no results.
+var ErrNotFound = errors.New("not found")
+
 // Parser implements parsing for SoundCloud URLs.
 type Parser struct {
 	api    *soundcloud.Api
@@ -33,11 +38,19 @@ func (p *Parser) Init(_ context.Context) error {
 		ClientId:     p.Config.ClientID,
 		ClientSecret: p.Config.ClientSecret,
 	}
-	p.http = &http.Client{}
+	if p.http == nil {
+		p.http = &http.Client{}
+	}
 
 	return nil
 }
 
+// SetHTTPClientFactory sets the factory of the HTTP client used for API
+// requests.
+func (p *Parser) SetHTTPClientFactory(f *httpclient.Factory) {
+	p.http = f.Client()
+}
+
 // Name returns the parser's descriptive name.
 func (p *Parser) Name() string {
 	return "SoundCloud"
@@ -98,23 +111,7 @@ func (p *Parser) Parse(ctx context.Context, u *url.URL, referer *url.URL) (resul
 		track := r.AsTrack()
 		log.Printf("Track: %+v", track)
 
-		info := map[string]interface{}{
-			"Header":      header,
-			"IsUpload":    true,
-			"Title":       track.Title,
-			"Author":      track.User.Username,
-			"Url":         track.PermalinkURL,
-			"Favorites":   track.LikesCount,
-			"Reposts":     track.RepostsCount,
-			"Plays":       track.PlaybackCount,
-			"Comments":    track.CommentCount,
-			"PublishedAt": track.CreatedAt.ToTime(""),
-			"Downloads":   track.DownloadCount,
-			// Doing /1000 here to get rid of the fraction
-			"Duration": (time.Duration(track.Duration) / 1000) * time.Second,
-		}
-
-		result.Information = []map[string]interface{}{info}
+		result.Information = []map[string]interface{}{trackInformation(track)}
 	case v2KindPlaylist:
 		pl := r.AsPlaylist()
 
@@ -139,3 +136,37 @@ func (p *Parser) Parse(ctx context.Context, u *url.URL, referer *url.URL) (resul
 
 	return
 }
+
+// Search looks up the track best matching the given query.
+func (p *Parser) Search(ctx context.Context, query string) (result parsers.ParseResult) {
+	tracks, err := p.v2searchTracks(ctx, query, 1)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	if len(tracks) < 1 {
+		result.UserError = ErrNotFound
+		return
+	}
+
+	result.Information = []map[string]interface{}{trackInformation(tracks[0])}
+	return
+}
+
+func trackInformation(track *v2Track) map[string]interface{} {
+	return map[string]interface{}{
+		"Header":      header,
+		"IsUpload":    true,
+		"Title":       track.Title,
+		"Author":      track.User.Username,
+		"Url":         track.PermalinkURL,
+		"Favorites":   track.LikesCount,
+		"Reposts":     track.RepostsCount,
+		"Plays":       track.PlaybackCount,
+		"Comments":    track.CommentCount,
+		"PublishedAt": track.CreatedAt.ToTime(""),
+		"Downloads":   track.DownloadCount,
+		// Doing /1000 here to get rid of the fraction
+		"Duration": (time.Duration(track.Duration) / 1000) * time.Second,
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -114,6 +115,22 @@ func (p *Parser) v2resolve(ctx context.Context, u string) (*v2ResolveResult, err
 	}
 }
 
+func (p *Parser) v2searchTracks(ctx context.Context, query string, limit int) ([]*v2Track, error) {
+	r, err := p.v2call(ctx, "/tracks", url.Values{
+		"q":     []string{query},
+		"limit": []string{strconv.Itoa(limit)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := []*v2Track{}
+	if err := r.Decoder().Decode(&tracks); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
 type v2Result []byte
 
 func (r v2Result) Decoder() *json.Decoder {
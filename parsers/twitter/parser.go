@@ -12,10 +12,12 @@ import (
 	"time"
 
 	"github.com/dghubble/go-twitter/twitter"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 
 	"github.com/icedream/irc-medialink/parsers"
 	"github.com/icedream/irc-medialink/util/clone"
+	"github.com/icedream/irc-medialink/util/httpclient"
 )
 
 const (
@@ -28,6 +30,8 @@ var ErrNotFound = errors.New("not found")
 // Parser implements parsing of Twitter URLs.
 type Parser struct {
 	Config *Config
+
+	http *http.Client
 }
 
 // Init initializes this parser.
@@ -41,6 +45,12 @@ func (p *Parser) Init(ctx context.Context) error {
 	return nil
 }
 
+// SetHTTPClientFactory sets the factory of the HTTP client used for API
+// requests.
+func (p *Parser) SetHTTPClientFactory(f *httpclient.Factory) {
+	p.http = f.Client()
+}
+
 // Name returns the parser's descriptive name.
 func (p *Parser) Name() string {
 	return "Twitter"
@@ -52,6 +62,10 @@ func (p *Parser) getTwitterClient(ctx context.Context) *twitter.Client {
 		ClientSecret: p.Config.ClientSecret,
 		TokenURL:     "https://api.twitter.com/oauth2/token",
 	}
+	if p.http != nil {
+		// The token source uses the client found in the context
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, p.http)
+	}
 	httpClient := config.Client(ctx)
 	return twitter.NewClient(httpClient)
 }
@@ -22,6 +22,7 @@ import (
 
 	"github.com/icedream/irc-medialink/parsers"
 	"github.com/icedream/irc-medialink/util/clone"
+	"github.com/icedream/irc-medialink/util/httpclient"
 	"github.com/icedream/irc-medialink/util/limitedio"
 	"github.com/icedream/irc-medialink/version"
 )
@@ -42,6 +43,8 @@ const (
 type Parser struct {
 	UserAgent string
 	Config    Config
+
+	transport http.RoundTripper
 }
 
 // Init initializes this parser.
@@ -57,6 +60,12 @@ func (p *Parser) Init(_ context.Context) error {
 	return nil
 }
 
+// SetHTTPClientFactory sets the factory of the HTTP transport used to fetch
+// pages.
+func (p *Parser) SetHTTPClientFactory(f *httpclient.Factory) {
+	p.transport = f.UntrustedTransport()
+}
+
 // Name returns the descriptive name of this parser.
 func (p *Parser) Name() string {
 	return "Web"
@@ -124,7 +133,11 @@ func (p *Parser) Parse(ctx context.Context, u *url.URL, referer *url.URL) (resul
 	if len(p.Config.AcceptLanguage) > 0 {
 		req.Header.Set("Accept-Language", p.Config.AcceptLanguage)
 	}
-	resp, err := http.DefaultTransport.RoundTrip(req)
+	transport := p.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
 	if err != nil {
 		result.Error = err
 		return
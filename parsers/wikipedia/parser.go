@@ -11,16 +11,35 @@ import (
 	"strings"
 
 	"github.com/icedream/irc-medialink/parsers"
+	"github.com/icedream/irc-medialink/util/httpclient"
 )
 
+// ErrNotFound is returned when a search yields no results.
+var ErrNotFound = errors.New("not found")
+
 // Parser implements parsing of Wikipedia URLs.
-type Parser struct{}
+type Parser struct {
+	http *http.Client
+}
 
 // Name returns the parser's descriptive name.
 func (p *Parser) Name() string {
 	return "Wikipedia"
 }
 
+// SetHTTPClientFactory sets the factory of the HTTP client used for API
+// requests.
+func (p *Parser) SetHTTPClientFactory(f *httpclient.Factory) {
+	p.http = f.Client()
+}
+
+func (p *Parser) client() *http.Client {
+	if p.http == nil {
+		return http.DefaultClient
+	}
+	return p.http
+}
+
 // Init initializes the parser.
 func (p *Parser) Init(_ context.Context) error {
 	return nil
@@ -50,35 +69,116 @@ func (p *Parser) Parse(ctx context.Context, u *url.URL, referer *url.URL) (resul
 			strings.EqualFold(u.Host, "www.wikipedia.org") {
 			u.Host = "en.wikipedia.org"
 		}
-		req, err := http.NewRequestWithContext(ctx, "GET", "https://"+u.Host+"/api/rest_v1/page/summary/"+titleEscaped, nil)
-		if err != nil {
-			result.Error = err
-			return
-		}
-		r, err := http.DefaultClient.Do(req)
-		if err != nil {
-			result.Error = err
-			return
-		}
-		defer r.Body.Close()
-		if r.StatusCode != 200 {
-			result.UserError = errors.New(r.Status)
-			return
-		}
-		data := v1Summary{}
-		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-			result.Error = err
-			return
-		}
-
-		result.Information = []map[string]interface{}{
-			{
-				"Header":      "\x031,0Wikipedia\x03",
-				"Description": prepareSummary(data.Title, data.Extract),
-			},
-		}
+		result = p.summary(ctx, u.Host, titleEscaped, "")
+		return
 	}
 
 	result.Ignored = result.Information == nil
 	return
 }
+
+// summary fetches the summary of the article with the given title from the
+// given Wikipedia host. If articleURL is not empty, it will be included in the
+// information.
+func (p *Parser) summary(ctx context.Context, host string, titleEscaped string, articleURL string) (result parsers.ParseResult) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+host+"/api/rest_v1/page/summary/"+titleEscaped, nil)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	r, err := p.client().Do(req)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		result.UserError = errors.New(r.Status)
+		return
+	}
+	data := v1Summary{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		result.Error = err
+		return
+	}
+
+	info := map[string]interface{}{
+		"Header":      "\x031,0Wikipedia\x03",
+		"Description": prepareSummary(data.Title, data.Extract),
+	}
+	if len(articleURL) > 0 {
+		info["Url"] = articleURL
+	}
+	result.Information = []map[string]interface{}{info}
+	return
+}
+
+// Search looks up the article best matching the given query. The query may
+// start with a language code like "de:" to search a specific Wikipedia.
+func (p *Parser) Search(ctx context.Context, query string) (result parsers.ParseResult) {
+	language, term := parseSearchQuery(query)
+	if len(term) == 0 {
+		result.UserError = ErrNotFound
+		return
+	}
+	host := language + ".wikipedia.org"
+
+	u := &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   "/w/api.php",
+		RawQuery: url.Values{
+			"action":    []string{"opensearch"},
+			"format":    []string{"json"},
+			"limit":     []string{"1"},
+			"namespace": []string{"0"},
+			"redirects": []string{"resolve"},
+			"search":    []string{term},
+		}.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	r, err := p.client().Do(req)
+	if err != nil {
+		result.Error = err
+		return
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		result.UserError = errors.New(r.Status)
+		return
+	}
+
+	// Response looks like [query, [titles...], [descriptions...], [urls...]]
+	data := []json.RawMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		result.Error = err
+		return
+	}
+	titles, urls := []string{}, []string{}
+	if len(data) < 4 {
+		result.Error = errors.New("unexpected opensearch response")
+		return
+	}
+	if err := json.Unmarshal(data[1], &titles); err != nil {
+		result.Error = err
+		return
+	}
+	if err := json.Unmarshal(data[3], &urls); err != nil {
+		result.Error = err
+		return
+	}
+	if len(titles) < 1 {
+		result.UserError = ErrNotFound
+		return
+	}
+	articleURL := ""
+	if len(urls) > 0 {
+		articleURL = urls[0]
+	}
+
+	return p.summary(ctx, host, url.PathEscape(strings.ReplaceAll(titles[0], " ", "_")), articleURL)
+}
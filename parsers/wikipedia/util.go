@@ -1,11 +1,29 @@
 package wikipedia
 
 import (
+	"regexp"
 	"strings"
 
 	"gopkg.in/neurosnap/sentences.v1/english"
 )
 
+const defaultLanguage = "en"
+
+// rxLanguagePrefix matches what may be language prefixes like "de:" or
+// "zh-yue:" in search queries.
+var rxLanguagePrefix = regexp.MustCompile(`^([a-z]{2,}(?:-[a-z]+)*):\s*`)
+
+// parseSearchQuery splits up a search query into the language code of the
+// Wikipedia to search and the actual search term. Prefixes that are not the
+// code of an existing Wikipedia are kept as part of the search term.
+func parseSearchQuery(query string) (language string, term string) {
+	query = strings.TrimSpace(query)
+	if m := rxLanguagePrefix.FindStringSubmatch(strings.ToLower(query)); m != nil && IsLanguage(m[1]) {
+		return m[1], strings.TrimSpace(query[len(m[0]):])
+	}
+	return defaultLanguage, query
+}
+
 func prepareSummary(title string, summary string) string {
 	// Sentence tokenizer - English will work fine in most cases for now
 	tokenizer, err := english.NewSentenceTokenizer(nil)
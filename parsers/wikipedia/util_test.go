@@ -0,0 +1,42 @@
+package wikipedia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseSearchQuery(t *testing.T) {
+	language, term := parseSearchQuery("Berlin")
+	assert.Equal(t, "en", language)
+	assert.Equal(t, "Berlin", term)
+
+	language, term = parseSearchQuery("de:Berlin")
+	assert.Equal(t, "de", language)
+	assert.Equal(t, "Berlin", term)
+
+	language, term = parseSearchQuery("DE: Berliner Mauer")
+	assert.Equal(t, "de", language)
+	assert.Equal(t, "Berliner Mauer", term)
+
+	language, term = parseSearchQuery("zh-yue:香港")
+	assert.Equal(t, "zh-yue", language)
+	assert.Equal(t, "香港", term)
+
+	// Not a language code
+	language, term = parseSearchQuery("Star Trek: Voyager")
+	assert.Equal(t, "en", language)
+	assert.Equal(t, "Star Trek: Voyager", term)
+
+	language, term = parseSearchQuery("go: channels")
+	assert.Equal(t, "en", language)
+	assert.Equal(t, "go: channels", term)
+
+	language, term = parseSearchQuery("simple:Moon")
+	assert.Equal(t, "simple", language)
+	assert.Equal(t, "Moon", term)
+
+	language, term = parseSearchQuery("evil.com/x:foo")
+	assert.Equal(t, "en", language)
+	assert.Equal(t, "evil.com/x:foo", term)
+}
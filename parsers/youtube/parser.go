@@ -16,6 +16,7 @@ import (
 
 	"github.com/icedream/irc-medialink/parsers"
 	"github.com/icedream/irc-medialink/util/clone"
+	"github.com/icedream/irc-medialink/util/httpclient"
 )
 
 const (
@@ -36,9 +37,27 @@ type youtubeReference uint8
 // Parser implements parsing of YouTube URLs via API.
 type Parser struct {
 	Config *Config
+
+	http  *http.Client
+	probe http.RoundTripper
+}
+
+// apiKeyTransport adds the API key to requests since the YouTube API ignores
+// option.WithAPIKey when a custom HTTP client is used.
+type apiKeyTransport struct {
+	key  string
+	next http.RoundTripper
 }
 
-func parseYouTubeURL(uri *url.URL, followRedirects int) (youtubeReference, string) {
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	q := req.URL.Query()
+	q.Set("key", t.key)
+	req.URL.RawQuery = q.Encode()
+	return t.next.RoundTrip(req)
+}
+
+func parseYouTubeURL(transport http.RoundTripper, uri *url.URL, followRedirects int) (youtubeReference, string) {
 	u := clone.CloneURL(uri)
 	u.Scheme = strings.ToLower(u.Scheme)
 	u.Host = strings.ToLower(u.Host)
@@ -81,14 +100,15 @@ func parseYouTubeURL(uri *url.URL, followRedirects int) (youtubeReference, strin
 				log.Printf("Failed to create HEAD request from %s: %s", u, err)
 				return nonYouTubeReference, ""
 			}
-			resp, err := http.DefaultTransport.RoundTrip(req)
+			resp, err := transport.RoundTrip(req)
 			if err != nil {
 				log.Printf("Failed to check for channel from %s: %s", u, err)
 				return nonYouTubeReference, ""
 			}
+			resp.Body.Close()
 			if resp.StatusCode >= 300 && resp.StatusCode < 400 {
 				if lu, err := resp.Location(); err == nil && lu != nil {
-					return parseYouTubeURL(lu, followRedirects-1)
+					return parseYouTubeURL(transport, lu, followRedirects-1)
 				}
 			}
 		}
@@ -97,6 +117,15 @@ func parseYouTubeURL(uri *url.URL, followRedirects int) (youtubeReference, strin
 	return nonYouTubeReference, ""
 }
 
+// SetHTTPClientFactory sets the factory of the HTTP clients used for API
+// requests and for checking whether links lead to a channel.
+func (p *Parser) SetHTTPClientFactory(f *httpclient.Factory) {
+	p.http = &http.Client{
+		Transport: &apiKeyTransport{key: p.Config.APIKey, next: f.Transport()},
+	}
+	p.probe = f.UntrustedTransport()
+}
+
 // Init initializes the parser.
 func (p *Parser) Init(_ context.Context) error {
 	if len(p.Config.APIKey) == 0 {
@@ -107,9 +136,11 @@ func (p *Parser) Init(_ context.Context) error {
 
 func (p *Parser) getYouTubeService(ctx context.Context) (*youtube.Service, error) {
 	// youtube api
-	srv, err := youtube.NewService(
-		ctx,
-		option.WithAPIKey(p.Config.APIKey))
+	opt := option.WithAPIKey(p.Config.APIKey)
+	if p.http != nil {
+		opt = option.WithHTTPClient(p.http)
+	}
+	srv, err := youtube.NewService(ctx, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +155,11 @@ func (p *Parser) Name() string {
 // Parse parses the given URL.
 func (p *Parser) Parse(ctx context.Context, u *url.URL, referer *url.URL) (result parsers.ParseResult) {
 	// Parse YouTube URL
-	idType, id := parseYouTubeURL(u, 2)
+	transport := p.probe
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	idType, id := parseYouTubeURL(transport, u, 2)
 	if idType == nonYouTubeReference {
 		result.Ignored = true
 		return // nothing relevant found in this URL
@@ -329,3 +364,34 @@ func (p *Parser) Parse(ctx context.Context, u *url.URL, referer *url.URL) (resul
 
 	return
 }
+
+// Search looks up the video best matching the given query.
+func (p *Parser) Search(ctx context.Context, query string) (result parsers.ParseResult) {
+	service, err := p.getYouTubeService(ctx)
+	if err != nil {
+		result.Error = err
+		return
+	}
+
+	list, err := service.Search.List([]string{"id"}).
+		Q(query).
+		Type("video").
+		MaxResults(1).
+		Context(ctx).
+		Do()
+	if err != nil {
+		result.Error = err
+		return
+	}
+	if len(list.Items) < 1 || list.Items[0].Id == nil || len(list.Items[0].Id.VideoId) == 0 {
+		result.UserError = ErrNotFound
+		return
+	}
+
+	// Reuse the video URL parsing to collect all the information
+	return p.Parse(ctx, &url.URL{
+		Scheme: "https",
+		Host:   "youtu.be",
+		Path:   "/" + list.Items[0].Id.VideoId,
+	}, nil)
+}
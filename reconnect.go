@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	irc "github.com/thoj/go-ircevent"
+)
+
+// backoff calculates the delays between reconnection attempts. Delays grow
+// exponentially up to a maximum and are randomly spread out so that bots
+// that lost their connection at the same time do not all reconnect at once.
+type backoff struct {
+	Min time.Duration
+	Max time.Duration
+	// Jitter is the fraction by which a delay may randomly deviate.
+	Jitter float64
+
+	attempts int
+	random   func() float64
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{
+		Min:    min,
+		Max:    max,
+		Jitter: 0.25,
+		random: rand.Float64,
+	}
+}
+
+// Next returns the delay to wait before the next attempt.
+func (b *backoff) Next() time.Duration {
+	delay := float64(b.Min) * math.Pow(2, float64(b.attempts))
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	} else {
+		b.attempts++
+	}
+
+	delay += delay * b.Jitter * (2*b.random() - 1)
+	return time.Duration(delay)
+}
+
+// Reset starts over with the minimum delay, to be called once a connection
+// turned out to be stable.
+func (b *backoff) Reset() {
+	b.attempts = 0
+}
+
+// serverList rotates through the configured servers on every connection
+// attempt.
+type serverList struct {
+	servers []string
+	next    int
+}
+
+// Next returns the server to connect to next.
+func (l *serverList) Next() string {
+	server := l.servers[l.next]
+	l.next = (l.next + 1) % len(l.servers)
+	return server
+}
+
+// connectTo connects to the given server. Connect alone does not set up what
+// a previous Disconnect tore down, so the goroutines of the new connection
+// could never be stopped and the next Disconnect would hang, Reconnect does.
+func connectTo(conn *irc.Connection, server string) error {
+	conn.Server = server
+	return conn.Reconnect()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	irc "github.com/thoj/go-ircevent"
+)
+
+func Test_Backoff(t *testing.T) {
+	b := newBackoff(5*time.Second, time.Minute)
+	b.random = func() float64 { return 0.5 }
+
+	assert.Equal(t, 5*time.Second, b.Next())
+	assert.Equal(t, 10*time.Second, b.Next())
+	assert.Equal(t, 20*time.Second, b.Next())
+	assert.Equal(t, 40*time.Second, b.Next())
+	assert.Equal(t, time.Minute, b.Next())
+	assert.Equal(t, time.Minute, b.Next())
+
+	b.Reset()
+	assert.Equal(t, 5*time.Second, b.Next())
+}
+
+func Test_Backoff_Jitter(t *testing.T) {
+	b := newBackoff(time.Minute, time.Minute)
+
+	b.random = func() float64 { return 0 }
+	assert.Equal(t, 45*time.Second, b.Next())
+	b.random = func() float64 { return 1 }
+	assert.Equal(t, 75*time.Second, b.Next())
+}
+
+func Test_ServerList(t *testing.T) {
+	l := &serverList{servers: []string{"a:6667", "b:6697"}}
+	assert.Equal(t, "a:6667", l.Next())
+	assert.Equal(t, "b:6697", l.Next())
+	assert.Equal(t, "a:6667", l.Next())
+}
+
+func Test_ConnectTo_Reconnect(t *testing.T) {
+	// The server drops every client once it registered
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(c)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || strings.HasPrefix(line, "USER ") {
+					break
+				}
+			}
+			c.Close()
+		}
+	}()
+
+	conn := irc.IRC("bot", "bot")
+	conn.Log = log.New(io.Discard, "", 0)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, connectTo(conn, l.Addr().String()))
+		select {
+		case <-conn.ErrorChan():
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection has not been dropped")
+		}
+
+		disconnected := make(chan struct{})
+		go func() {
+			conn.Disconnect()
+			close(disconnected)
+		}()
+		select {
+		case <-disconnected:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("disconnecting hangs after connection %d", i+1)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rejoinStableTime is how long we have to stay in a channel after rejoining
+// it for a following kick to count as a new one instead of another attempt.
+const rejoinStableTime = 1 * time.Minute
+
+type rejoinConn interface {
+	Join(channel string)
+}
+
+// pendingRejoin keeps track of rejoining a single channel we got kicked from.
+type pendingRejoin struct {
+	channel  string
+	key      string
+	attempts int
+	timer    *time.Timer
+	joinedAt time.Time
+}
+
+// rejoiner rejoins channels we got kicked from after a delay, giving up after
+// a number of attempts. It is safe for concurrent use.
+type rejoiner struct {
+	lock    sync.Mutex
+	conn    rejoinConn
+	pending map[string]*pendingRejoin
+
+	// Delay is how long to wait before each attempt to rejoin.
+	Delay time.Duration
+
+	// MaxAttempts is how often we try to rejoin a channel, zero disables
+	// rejoining.
+	MaxAttempts int
+
+	// OnGiveUp is called when we stop trying to rejoin a channel.
+	OnGiveUp func(channel string)
+
+	now func() time.Time
+}
+
+func newRejoiner(conn rejoinConn, delay time.Duration, maxAttempts int) *rejoiner {
+	return &rejoiner{
+		conn:        conn,
+		pending:     map[string]*pendingRejoin{},
+		Delay:       delay,
+		MaxAttempts: maxAttempts,
+		now:         time.Now,
+	}
+}
+
+// Kicked is called when we got kicked from a channel. It returns false if we
+// are not going to rejoin the channel.
+func (r *rejoiner) Kicked(channel, key string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	p, ok := r.pending[foldName(channel)]
+	if !ok || (!p.joinedAt.IsZero() && r.now().Sub(p.joinedAt) > rejoinStableTime) {
+		// Start counting over
+		p = &pendingRejoin{channel: channel}
+		r.pending[foldName(channel)] = p
+	}
+	if len(key) > 0 {
+		p.key = key
+	}
+	p.joinedAt = time.Time{}
+	return r.schedule(p)
+}
+
+// Failed is called when the server did not let us join a channel. It returns
+// false if we were not trying to rejoin it.
+func (r *rejoiner) Failed(channel string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	p, ok := r.pending[foldName(channel)]
+	if !ok || !p.joinedAt.IsZero() {
+		return false
+	}
+	r.schedule(p)
+	return true
+}
+
+// Joined is called when we joined a channel.
+func (r *rejoiner) Joined(channel string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if p, ok := r.pending[foldName(channel)]; ok {
+		p.timer.Stop()
+		p.joinedAt = r.now()
+	}
+}
+
+// IsRejoining checks whether we are waiting to rejoin the given channel.
+func (r *rejoiner) IsRejoining(channel string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	p, ok := r.pending[foldName(channel)]
+	return ok && p.joinedAt.IsZero()
+}
+
+// Cancel stops trying to rejoin the given channel.
+func (r *rejoiner) Cancel(channel string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if p, ok := r.pending[foldName(channel)]; ok {
+		p.timer.Stop()
+		delete(r.pending, foldName(channel))
+	}
+}
+
+// Reset stops all attempts to rejoin channels, for example when we got
+// disconnected.
+func (r *rejoiner) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for name, p := range r.pending {
+		p.timer.Stop()
+		delete(r.pending, name)
+	}
+}
+
+// schedule plans the next attempt to rejoin the channel or gives up. The
+// lock must be held by the caller.
+func (r *rejoiner) schedule(p *pendingRejoin) bool {
+	if p.attempts >= r.MaxAttempts {
+		delete(r.pending, foldName(p.channel))
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		if r.OnGiveUp != nil {
+			go r.OnGiveUp(p.channel)
+		}
+		return false
+	}
+
+	p.attempts++
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(r.Delay, func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		if r.pending[foldName(p.channel)] != p || !p.joinedAt.IsZero() {
+			return
+		}
+		if len(p.key) > 0 {
+			r.conn.Join(p.channel + " " + p.key)
+		} else {
+			r.conn.Join(p.channel)
+		}
+	})
+	return true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingRejoinConn struct {
+	lock  sync.Mutex
+	joins []string
+}
+
+func (c *recordingRejoinConn) Join(channel string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.joins = append(c.joins, channel)
+}
+
+func (c *recordingRejoinConn) Joins() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string{}, c.joins...)
+}
+
+func Test_Rejoiner(t *testing.T) {
+	conn := new(recordingRejoinConn)
+	r := newRejoiner(conn, time.Millisecond, 2)
+	gaveUp := make(chan string, 1)
+	r.OnGiveUp = func(channel string) {
+		gaveUp <- channel
+	}
+
+	require.True(t, r.Kicked("#Channel", "key"))
+	assert.True(t, r.IsRejoining("#channel"))
+	assert.Eventually(t, func() bool {
+		return len(conn.Joins()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "#Channel key", conn.Joins()[0])
+
+	// Banned, try again
+	require.True(t, r.Failed("#channel"))
+	assert.Eventually(t, func() bool {
+		return len(conn.Joins()) == 2
+	}, time.Second, time.Millisecond)
+
+	// Still banned, give up
+	require.True(t, r.Failed("#channel"))
+	assert.Equal(t, "#Channel", <-gaveUp)
+	assert.False(t, r.IsRejoining("#channel"))
+	assert.False(t, r.Failed("#channel"))
+}
+
+func Test_Rejoiner_KickedAgain(t *testing.T) {
+	conn := new(recordingRejoinConn)
+	r := newRejoiner(conn, time.Hour, 2)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	require.True(t, r.Kicked("#channel", ""))
+	r.Joined("#channel")
+	assert.False(t, r.IsRejoining("#channel"))
+	assert.False(t, r.Failed("#channel"))
+
+	// Getting kicked right after rejoining counts as another attempt
+	require.True(t, r.Kicked("#channel", ""))
+	r.Joined("#channel")
+	assert.False(t, r.Kicked("#channel", ""))
+
+	// After staying for a while we start over
+	require.True(t, r.Kicked("#channel", ""))
+	r.Joined("#channel")
+	now = now.Add(2 * rejoinStableTime)
+	assert.True(t, r.Kicked("#channel", ""))
+
+	r.Cancel("#channel")
+	assert.False(t, r.IsRejoining("#channel"))
+}
+
+func Test_Rejoiner_Disabled(t *testing.T) {
+	r := newRejoiner(new(recordingRejoinConn), time.Millisecond, 0)
+	assert.False(t, r.Kicked("#channel", ""))
+	assert.False(t, r.IsRejoining("#channel"))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/icedream/irc-medialink/manager"
+)
+
+// newSearchCommand creates the handler for a command that searches for
+// content using the given parser and posts the top result to the channel.
+func newSearchCommand(ctx context.Context, conn ircReplier, m *manager.Manager, searcher manager.Searcher, settings *settingsStore, caps *capNegotiator, timeout time.Duration) commandHandlerFunc {
+	return func(cmd *commandContext) {
+		if !cmd.IsChannel {
+			conn.Notice(cmd.Nick, "This command can only be used in a channel.")
+			return
+		}
+
+		cs := settings.Channel(cmd.Target)
+		if cs.Disabled || !cs.IsParserEnabled(searcher.Name()) {
+			return
+		}
+		sender := cmd.Sender
+		if settings.IsIgnored(sender) || matchIgnoreList(cs.Ignore, sender) ||
+			(sender.IsBot && !cs.AllowBots) {
+			return
+		}
+
+		// Ignore user if they just joined
+		if m.TrackUser(cmd.Target, sender.antifloodIdentity(caps)) {
+			log.Print("This search will be ignored since the user just joined.")
+			return
+		}
+
+		if len(cmd.ArgLine) == 0 {
+			conn.Noticef(cmd.Nick, "Usage: %s%s <search terms>", cmd.Prefix, cmd.Name)
+			return
+		}
+
+		// Every search uses up a part of the API quota
+		if m.TrackSearch(searcher.Name(), sender.antifloodIdentity(caps)) {
+			log.Printf("Search rate limit triggered for %s.", cmd.Source)
+			conn.Noticef(cmd.Nick, "Too many searches, please wait a few minutes before searching %s again.", searcher.Name())
+			return
+		}
+
+		sctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		result := m.Search(sctx, searcher, cmd.ArgLine)
+		if result.Error != nil {
+			log.Printf("WARNING: %s search for %q failed: %s", searcher.Name(), cmd.ArgLine, result.Error.Error())
+			if !cs.HideErrors {
+				conn.Noticef(cmd.Nick, "Searching %s failed, please try again later.", searcher.Name())
+			}
+			return
+		}
+		if result.UserError != nil {
+			if s, err := tplString("error", result.UserError); err != nil {
+				log.Print(err)
+			} else if !cs.HideErrors {
+				sendChannelOutput(conn, cmd.Target, &cs, false, s)
+			}
+			return
+		}
+
+		// Only post the top result
+		if len(result.Information) == 0 {
+			return
+		}
+		info := result.Information[0]
+		info["IsSearchResult"] = true
+		if s, err := tplString("link-info", info); err != nil {
+			log.Print(err)
+		} else {
+			sendChannelOutput(conn, cmd.Target, &cs, false, s)
+		}
+	}
+}
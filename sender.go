@@ -0,0 +1,54 @@
+package main
+
+import (
+	irc "github.com/thoj/go-ircevent"
+
+	"github.com/icedream/irc-medialink/manager"
+)
+
+// messageSender describes the user who sent a message we are handling.
+type messageSender struct {
+	Nick   string
+	Source string
+
+	// Account is the services account of the user, empty if unknown or not
+	// logged in.
+	Account string
+
+	// IsBot is set if the user has been marked as a bot by the server.
+	IsBot bool
+
+	// Bridge is the nickname of the bridge bot that relayed the message,
+	// empty if the message has been sent on IRC directly.
+	Bridge string
+}
+
+// senderFromEvent collects what we know about the sender of the given
+// event.
+func senderFromEvent(e *irc.Event) *messageSender {
+	sender := &messageSender{
+		Nick:   e.Nick,
+		Source: e.Source,
+	}
+	if account, ok := e.Tags["account"]; ok {
+		sender.Account = account
+	} else if account, ok := getUserAccount(e.Nick); ok {
+		sender.Account = account
+	}
+	if _, ok := e.Tags["bot"]; ok {
+		sender.IsBot = true
+	} else {
+		sender.IsBot = isKnownBot(e.Nick)
+	}
+	return sender
+}
+
+// antifloodIdentity returns what antiflood should know the sender by. Users
+// relayed by a bridge are told apart by their nickname.
+func (sender *messageSender) antifloodIdentity(caps *capNegotiator) string {
+	if len(sender.Bridge) > 0 {
+		// All relayed users share the bridge's hostmask
+		return manager.BridgedIdentity(sender.Bridge, sender.Nick)
+	}
+	return antifloodIdentity(caps, sender.Source, sender.Account)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// channelSettings contains the options channel operators can change for
+// their channel.
+type channelSettings struct {
+	// Disabled pauses link parsing in the channel.
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// DisabledParsers contains the names of parsers that should not be used
+	// for links posted in the channel.
+	DisabledParsers []string `yaml:"disabledParsers,omitempty"`
+
+	// DisabledShorthands contains the names of shorthands such as r/golang
+	// that should not be recognized in the channel.
+	DisabledShorthands []string `yaml:"disabledShorthands,omitempty"`
+
+	// StripFormatting removes colors and other formatting from our output
+	// even if the channel allows them.
+	StripFormatting bool `yaml:"stripFormatting,omitempty"`
+
+	// HideErrors suppresses error messages about links that could not be
+	// parsed.
+	HideErrors bool `yaml:"hideErrors,omitempty"`
+
+	// UseNotice makes us send link information as NOTICE instead of PRIVMSG.
+	UseNotice bool `yaml:"useNotice,omitempty"`
+
+	// Ignore contains masks of users whose messages are ignored in the
+	// channel, see matchIgnoreMask for the format.
+	Ignore []string `yaml:"ignore,omitempty"`
+
+	// AllowBots makes us handle messages from users that are marked as bots.
+	AllowBots bool `yaml:"allowBots,omitempty"`
+
+	// AllowedDomains restricts link parsing to the given domains if not
+	// empty, see matchDomain for the format.
+	AllowedDomains []string `yaml:"allowedDomains,omitempty"`
+
+	// DeniedDomains contains domains whose links are never fetched in the
+	// channel, see matchDomain for the format.
+	DeniedDomains []string `yaml:"deniedDomains,omitempty"`
+}
+
+// IsParserEnabled checks whether the parser with the given name may be used
+// in the channel.
+func (cs *channelSettings) IsParserEnabled(name string) bool {
+	for _, disabledName := range cs.DisabledParsers {
+		if strings.EqualFold(disabledName, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetParserEnabled enables or disables the parser with the given name.
+func (cs *channelSettings) SetParserEnabled(name string, enabled bool) {
+	disabledParsers := []string{}
+	for _, disabledName := range cs.DisabledParsers {
+		if !strings.EqualFold(disabledName, name) {
+			disabledParsers = append(disabledParsers, disabledName)
+		}
+	}
+	if !enabled {
+		disabledParsers = append(disabledParsers, name)
+	}
+	sort.Strings(disabledParsers)
+	cs.DisabledParsers = disabledParsers
+}
+
+// IsShorthandEnabled checks whether the shorthand with the given name is
+// recognized in the channel.
+func (cs *channelSettings) IsShorthandEnabled(name string) bool {
+	for _, disabledName := range cs.DisabledShorthands {
+		if strings.EqualFold(disabledName, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetShorthandEnabled enables or disables the shorthand with the given name.
+func (cs *channelSettings) SetShorthandEnabled(name string, enabled bool) {
+	disabledShorthands := []string{}
+	for _, disabledName := range cs.DisabledShorthands {
+		if !strings.EqualFold(disabledName, name) {
+			disabledShorthands = append(disabledShorthands, disabledName)
+		}
+	}
+	if !enabled {
+		disabledShorthands = append(disabledShorthands, name)
+	}
+	sort.Strings(disabledShorthands)
+	cs.DisabledShorthands = disabledShorthands
+}
+
+// IsDomainAllowed checks whether links to the given host may be fetched in
+// the channel. Denied domains take precedence over allowed ones.
+func (cs *channelSettings) IsDomainAllowed(host string) bool {
+	if matchDomainList(cs.DeniedDomains, host) {
+		return false
+	}
+	return len(cs.AllowedDomains) == 0 || matchDomainList(cs.AllowedDomains, host)
+}
+
+func (cs *channelSettings) isEmpty() bool {
+	return !cs.Disabled &&
+		len(cs.DisabledParsers) == 0 &&
+		len(cs.DisabledShorthands) == 0 &&
+		!cs.StripFormatting &&
+		!cs.HideErrors &&
+		!cs.UseNotice &&
+		len(cs.Ignore) == 0 &&
+		!cs.AllowBots &&
+		len(cs.AllowedDomains) == 0 &&
+		len(cs.DeniedDomains) == 0
+}
+
+// joinedChannel describes a channel we are in so we can rejoin it after a
+// reconnect or restart.
+type joinedChannel struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key,omitempty"`
+}
+
+// settingsFile describes the layout of the file settings are persisted to.
+type settingsFile struct {
+	// Ignore contains masks of users whose messages are ignored in all
+	// channels, see matchIgnoreMask for the format.
+	Ignore []string `yaml:"ignore,omitempty"`
+
+	// Joined contains the channels we are in, sorted by name.
+	Joined []joinedChannel `yaml:"joined,omitempty"`
+
+	Channels map[string]*channelSettings `yaml:"channels,omitempty"`
+}
+
+// settingsStore keeps settings in memory and persists them to a file on
+// every change.
+type settingsStore struct {
+	lock sync.RWMutex
+	path string
+	data settingsFile
+}
+
+func newSettingsStore(path string) *settingsStore {
+	return &settingsStore{
+		path: path,
+		data: settingsFile{
+			Channels: map[string]*channelSettings{},
+		},
+	}
+}
+
+// Load reads the settings from the file. A missing file is not an error.
+func (s *settingsStore) Load() error {
+	data := settingsFile{}
+	if len(s.path) > 0 {
+		b, err := os.ReadFile(s.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(b, &data); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Normalize channel names so lookups will work
+	channels := map[string]*channelSettings{}
+	for name, cs := range data.Channels {
+		if cs != nil {
+			channels[foldName(name)] = cs
+		}
+	}
+	data.Channels = channels
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data = data
+	return nil
+}
+
+// save writes the settings to the file. The lock must be held by the caller.
+func (s *settingsStore) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	b, err := yaml.Marshal(&s.data)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so we never leave a broken file behind
+	f, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// Channel returns a copy of the settings for the given channel.
+func (s *settingsStore) Channel(channel string) channelSettings {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	cs, ok := s.data.Channels[foldName(channel)]
+	if !ok {
+		return channelSettings{}
+	}
+	result := *cs
+	result.DisabledParsers = append([]string{}, cs.DisabledParsers...)
+	result.Ignore = append([]string{}, cs.Ignore...)
+	result.AllowedDomains = append([]string{}, cs.AllowedDomains...)
+	result.DeniedDomains = append([]string{}, cs.DeniedDomains...)
+	result.DisabledShorthands = append([]string{}, cs.DisabledShorthands...)
+	return result
+}
+
+// UpdateChannel changes the settings of the given channel and persists
+// them.
+func (s *settingsStore) UpdateChannel(channel string, update func(cs *channelSettings)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	channel = foldName(channel)
+	cs, ok := s.data.Channels[channel]
+	if !ok {
+		cs = new(channelSettings)
+	}
+	update(cs)
+	if cs.isEmpty() {
+		delete(s.data.Channels, channel)
+	} else {
+		s.data.Channels[channel] = cs
+	}
+
+	return s.save()
+}
+
+// IgnoreMasks returns the masks of globally ignored users.
+func (s *settingsStore) IgnoreMasks() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]string{}, s.data.Ignore...)
+}
+
+// AddIgnoreMask adds a mask to the global ignore list and persists it.
+// Returns false if the mask is already on the list.
+func (s *settingsStore) AddIgnoreMask(mask string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var added bool
+	s.data.Ignore, added = addIgnoreMask(s.data.Ignore, mask)
+	if !added {
+		return false, nil
+	}
+	return true, s.save()
+}
+
+// RemoveIgnoreMask removes a mask from the global ignore list and persists
+// the change. Returns false if the mask was not on the list.
+func (s *settingsStore) RemoveIgnoreMask(mask string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var removed bool
+	s.data.Ignore, removed = removeIgnoreMask(s.data.Ignore, mask)
+	if !removed {
+		return false, nil
+	}
+	return true, s.save()
+}
+
+// IsIgnored checks whether the sender of a message matches the global ignore
+// list.
+func (s *settingsStore) IsIgnored(sender *messageSender) bool {
+	return matchIgnoreList(s.IgnoreMasks(), sender)
+}
+
+// JoinedChannels returns the channels we were in the last time.
+func (s *settingsStore) JoinedChannels() []joinedChannel {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]joinedChannel{}, s.data.Joined...)
+}
+
+// findJoinedChannel returns the index of the given channel in the list of
+// joined channels or -1. The lock must be held by the caller.
+func (s *settingsStore) findJoinedChannel(channel string) int {
+	for i, joined := range s.data.Joined {
+		if isSameName(joined.Name, channel) {
+			return i
+		}
+	}
+	return -1
+}
+
+// JoinedChannelKey returns the key we know for a channel we are in.
+func (s *settingsStore) JoinedChannelKey(channel string) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if i := s.findJoinedChannel(channel); i >= 0 {
+		return s.data.Joined[i].Key
+	}
+	return ""
+}
+
+// AddJoinedChannel remembers that we joined the given channel and persists
+// it. An empty key keeps the key we already know for the channel.
+func (s *settingsStore) AddJoinedChannel(channel string, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if i := s.findJoinedChannel(channel); i >= 0 {
+		if len(key) == 0 || s.data.Joined[i].Key == key {
+			return nil
+		}
+		s.data.Joined[i].Key = key
+		return s.save()
+	}
+
+	s.data.Joined = append(s.data.Joined, joinedChannel{Name: channel, Key: key})
+	sort.Slice(s.data.Joined, func(i, j int) bool {
+		return foldName(s.data.Joined[i].Name) < foldName(s.data.Joined[j].Name)
+	})
+	return s.save()
+}
+
+// SetJoinedChannelKey changes the key of a channel we are in and persists
+// it. An empty key removes the key. Channels we are not in are ignored.
+func (s *settingsStore) SetJoinedChannelKey(channel string, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := s.findJoinedChannel(channel)
+	if i < 0 || s.data.Joined[i].Key == key {
+		return nil
+	}
+	s.data.Joined[i].Key = key
+	return s.save()
+}
+
+// RemoveJoinedChannel forgets about a channel we left and persists the
+// change.
+func (s *settingsStore) RemoveJoinedChannel(channel string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	i := s.findJoinedChannel(channel)
+	if i < 0 {
+		return nil
+	}
+	s.data.Joined = append(s.data.Joined[:i], s.data.Joined[i+1:]...)
+	return s.save()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SettingsStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.yml")
+
+	s := newSettingsStore(path)
+	require.NoError(t, s.Load())
+	assert.False(t, s.Channel("#test").Disabled)
+
+	require.NoError(t, s.UpdateChannel("#Test", func(cs *channelSettings) {
+		cs.Disabled = true
+		cs.SetParserEnabled("Web", false)
+		cs.SetParserEnabled("YouTube", false)
+		cs.SetParserEnabled("YouTube", true)
+	}))
+
+	s2 := newSettingsStore(path)
+	require.NoError(t, s2.Load())
+	cs := s2.Channel("#TEST")
+	assert.True(t, cs.Disabled)
+	assert.Equal(t, []string{"Web"}, cs.DisabledParsers)
+	assert.False(t, cs.IsParserEnabled("web"))
+	assert.True(t, cs.IsParserEnabled("YouTube"))
+
+	// Settings equal to the defaults are removed from the file
+	require.NoError(t, s2.UpdateChannel("#test", func(cs *channelSettings) {
+		cs.Disabled = false
+		cs.SetParserEnabled("Web", true)
+	}))
+	assert.Empty(t, s2.data.Channels)
+}
+
+func Test_SettingsStore_ChannelCopy(t *testing.T) {
+	s := newSettingsStore(filepath.Join(t.TempDir(), "settings.yml"))
+	require.NoError(t, s.Load())
+	require.NoError(t, s.UpdateChannel("#test", func(cs *channelSettings) {
+		cs.SetShorthandEnabled("reddit", false)
+	}))
+
+	// Changing the returned settings does not change the stored ones
+	cs := s.Channel("#test")
+	cs.DisabledShorthands[0] = "youtube"
+	stored := s.Channel("#test")
+	assert.False(t, stored.IsShorthandEnabled("reddit"))
+	assert.True(t, stored.IsShorthandEnabled("youtube"))
+}
+
+func Test_ChannelSettings_IsDomainAllowed(t *testing.T) {
+	cs := channelSettings{}
+	assert.True(t, cs.IsDomainAllowed("example.com"))
+
+	cs.DeniedDomains = []string{"*.example.com"}
+	assert.False(t, cs.IsDomainAllowed("www.example.com"))
+	assert.True(t, cs.IsDomainAllowed("example.org"))
+
+	cs.AllowedDomains = []string{"*.youtube.com", "youtu.be", "*.example.com"}
+	assert.True(t, cs.IsDomainAllowed("youtu.be"))
+	assert.True(t, cs.IsDomainAllowed("m.youtube.com"))
+	assert.False(t, cs.IsDomainAllowed("example.org"))
+	assert.False(t, cs.IsDomainAllowed("example.com"))
+}
+
+func Test_SettingsStore_JoinedChannels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.yml")
+
+	s := newSettingsStore(path)
+	require.NoError(t, s.Load())
+	require.NoError(t, s.AddJoinedChannel("#Test", ""))
+	require.NoError(t, s.AddJoinedChannel("#keyed", "secret"))
+	require.NoError(t, s.AddJoinedChannel("#another", ""))
+
+	// Rejoining without a key keeps the known key
+	require.NoError(t, s.AddJoinedChannel("#KEYED", ""))
+	require.NoError(t, s.SetJoinedChannelKey("#test", "new"))
+	require.NoError(t, s.SetJoinedChannelKey("#unknown", "key"))
+
+	s2 := newSettingsStore(path)
+	require.NoError(t, s2.Load())
+	assert.Equal(t, []joinedChannel{
+		{Name: "#another"},
+		{Name: "#keyed", Key: "secret"},
+		{Name: "#Test", Key: "new"},
+	}, s2.JoinedChannels())
+
+	assert.Equal(t, "secret", s2.JoinedChannelKey("#Keyed"))
+	assert.Empty(t, s2.JoinedChannelKey("#unknown"))
+
+	require.NoError(t, s2.RemoveJoinedChannel("#TEST"))
+	require.NoError(t, s2.SetJoinedChannelKey("#keyed", ""))
+	assert.Equal(t, []joinedChannel{
+		{Name: "#another"},
+		{Name: "#keyed"},
+	}, s2.JoinedChannels())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/icedream/irc-medialink/parsers/wikipedia"
+)
+
+// shorthand describes a short way users refer to content without posting a
+// full link, such as "r/golang" for a subreddit.
+type shorthand struct {
+	// Example shows users what the shorthand looks like.
+	Example string
+
+	// Pattern matches the shorthand, its "ref" group must cover the whole
+	// reference as typed by the user.
+	Pattern *regexp.Regexp
+
+	// URL builds the canonical URL from the named groups of Pattern.
+	URL func(groups map[string]string) string
+}
+
+// shorthands contains the recognized shorthands by name. References have to
+// start at the beginning of the message or after whitespace or an opening
+// bracket so that parts of links and words are not taken for them.
+var shorthands = map[string]shorthand{
+	"reddit": {
+		Example: "r/golang",
+		Pattern: regexp.MustCompile(`(?:^|[\s(])(?P<ref>/?r/(?P<subreddit>[A-Za-z0-9][A-Za-z0-9_]{1,20}))(?:$|[^\w/])`),
+		URL: func(groups map[string]string) string {
+			return "https://www.reddit.com/r/" + groups["subreddit"] + "/"
+		},
+	},
+	"wikipedia": {
+		// The title runs until the end of the message since titles
+		// frequently contain spaces, trailing punctuation is dropped.
+		Example: "wp:Go (programming language)",
+		Pattern: regexp.MustCompile(`(?:^|[\s(])(?P<ref>(?i:wp):(?:(?P<language>[a-z]{2,}(?:-[a-z]+)*):)?(?P<title>[^\s<>][^<>]*))(?:$|>)`),
+		URL: func(groups map[string]string) string {
+			language, title := groups["language"], groups["title"]
+			if len(language) > 0 && !wikipedia.IsLanguage(language) {
+				// Part of the title, such as in "wp:Star Wars:Andor"
+				language, title = "", language+":"+title
+			}
+			if len(language) == 0 {
+				language = "en"
+			}
+			u := &url.URL{
+				Scheme: "https",
+				Host:   language + ".wikipedia.org",
+				Path:   "/wiki/" + strings.ReplaceAll(trimLinkSuffix(strings.TrimSpace(title)), " ", "_"),
+			}
+			return u.String()
+		},
+	},
+	"youtube": {
+		Example: "yt:dQw4w9WgXcQ",
+		Pattern: regexp.MustCompile(`(?:^|[\s(])(?P<ref>(?i:yt):(?P<id>[A-Za-z0-9_-]{11}))(?:$|[^A-Za-z0-9_-])`),
+		URL: func(groups map[string]string) string {
+			return "https://www.youtube.com/watch?v=" + groups["id"]
+		},
+	},
+	"fediverse": {
+		Example: "@user@mastodon.social",
+		Pattern: regexp.MustCompile(`(?:^|[\s(])(?P<ref>@(?P<user>[A-Za-z0-9_.-]*[A-Za-z0-9_])@(?P<host>[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+))`),
+		URL: func(groups map[string]string) string {
+			return "https://" + strings.ToLower(groups["host"]) + "/@" + groups["user"]
+		},
+	},
+}
+
+func shorthandNames() []string {
+	names := make([]string, 0, len(shorthands))
+	for name := range shorthands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FindShorthand returns the canonical URL for the first shorthand reference
+// in the message that is enabled and that users did not opt out of having
+// previewed, or an empty string.
+func (f *linkFinder) FindShorthand(msg string, enabled func(name string) bool) string {
+	if f.OptOuts != nil && f.OptOuts.MessageOptedOut(msg) {
+		return ""
+	}
+
+	link, linkStart := "", len(msg)
+	for _, name := range shorthandNames() {
+		if enabled != nil && !enabled(name) {
+			continue
+		}
+		s := shorthands[name]
+		refIndex := s.Pattern.SubexpIndex("ref")
+		for _, loc := range s.Pattern.FindAllStringSubmatchIndex(msg, -1) {
+			start, end := loc[2*refIndex], loc[2*refIndex+1]
+			if start >= linkStart {
+				break
+			}
+			if f.OptOuts != nil && f.OptOuts.URLOptedOut(msg, start, end) {
+				continue
+			}
+			groups := map[string]string{}
+			for i, groupName := range s.Pattern.SubexpNames() {
+				if len(groupName) > 0 && loc[2*i] >= 0 {
+					groups[groupName] = msg[loc[2*i]:loc[2*i+1]]
+				}
+			}
+			link, linkStart = s.URL(groups), start
+			break
+		}
+	}
+	return link
+}
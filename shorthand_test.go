@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LinkFinder_FindShorthand(t *testing.T) {
+	f := &linkFinder{OptOuts: &optOuts{Markers: []string{"!"}}}
+
+	assert.Equal(t, "https://www.reddit.com/r/golang/", f.FindShorthand("check out r/golang", nil))
+	assert.Equal(t, "https://www.reddit.com/r/golang/", f.FindShorthand("(/r/golang)", nil))
+	assert.Equal(t, "https://en.wikipedia.org/wiki/Go_%28programming_language%29",
+		f.FindShorthand("see wp:Go (programming language).", nil))
+	assert.Equal(t, "https://de.wikipedia.org/wiki/Berlin", f.FindShorthand("WP:de:Berlin", nil))
+	assert.Equal(t, "https://en.wikipedia.org/wiki/go:channels", f.FindShorthand("wp:go:channels", nil))
+	assert.Equal(t, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", f.FindShorthand("yt:dQw4w9WgXcQ!", nil))
+	assert.Equal(t, "https://mastodon.social/@user", f.FindShorthand("follow @user@Mastodon.social.", nil))
+
+	// The first reference wins
+	assert.Equal(t, "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		f.FindShorthand("yt:dQw4w9WgXcQ or r/golang", nil))
+
+	// Things that are no shorthands
+	assert.Empty(t, f.FindShorthand("see example.com/r/golang", nil))
+	assert.Empty(t, f.FindShorthand("our/golang", nil))
+	assert.Empty(t, f.FindShorthand("yt:tooshort", nil))
+	assert.Empty(t, f.FindShorthand("mail me at user@example.com", nil))
+
+	// Opting out
+	assert.Empty(t, f.FindShorthand("<r/golang>", nil))
+	assert.Empty(t, f.FindShorthand("<wp:Berlin> is nice", nil))
+	assert.Empty(t, f.FindShorthand("!yt:dQw4w9WgXcQ", nil))
+
+	// Disabled shorthands
+	cs := &channelSettings{}
+	cs.SetShorthandEnabled("reddit", false)
+	assert.Empty(t, f.FindShorthand("r/golang", cs.IsShorthandEnabled))
+	assert.Equal(t, "https://mastodon.social/@user",
+		f.FindShorthand("r/golang @user@mastodon.social", cs.IsShorthandEnabled))
+}
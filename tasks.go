@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// taskTracker keeps track of running message handlers so that we can let
+// them finish before shutting down.
+type taskTracker struct {
+	lock    sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+// Start registers a new task. It returns false if we are shutting down, in
+// which case the task should not be run.
+func (t *taskTracker) Start() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return false
+	}
+	t.running.Add(1)
+	return true
+}
+
+// Done marks a task started with Start as finished.
+func (t *taskTracker) Done() {
+	t.running.Done()
+}
+
+// Close stops accepting new tasks and waits for running tasks to finish or
+// the context to be done.
+func (t *taskTracker) Close(ctx context.Context) error {
+	t.lock.Lock()
+	t.closed = true
+	t.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
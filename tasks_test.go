@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TaskTracker_Close(t *testing.T) {
+	tasks := new(taskTracker)
+	require.True(t, tasks.Start())
+
+	finished := make(chan struct{})
+	go func() {
+		defer tasks.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(finished)
+	}()
+
+	require.NoError(t, tasks.Close(context.Background()))
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Close returned before the task finished")
+	}
+
+	assert.False(t, tasks.Start())
+}
+
+func Test_TaskTracker_Close_Timeout(t *testing.T) {
+	tasks := new(taskTracker)
+	require.True(t, tasks.Start())
+	defer tasks.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, tasks.Close(ctx), context.DeadlineExceeded)
+}
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -97,17 +98,39 @@ var (
 		},
 	}
 
-	ircTpl = template.Must(
-		template.New("").
-			Funcs(tplFuncMap).
-			ParseGlob("*.tpl"))
+	ircTpl     = template.Must(loadTemplates())
+	ircTplLock sync.RWMutex
 
 	rxInsignificantWhitespace = regexp.MustCompile(`\s+`)
 )
 
+func loadTemplates() (*template.Template, error) {
+	return template.New("").
+		Funcs(tplFuncMap).
+		ParseGlob("*.tpl")
+}
+
+// reloadTemplates reads the template files again. The previously loaded
+// templates are kept if the files can not be parsed.
+func reloadTemplates() error {
+	tpl, err := loadTemplates()
+	if err != nil {
+		return err
+	}
+
+	ircTplLock.Lock()
+	defer ircTplLock.Unlock()
+	ircTpl = tpl
+	return nil
+}
+
 func tplString(name string, data interface{}) (string, error) {
+	ircTplLock.RLock()
+	tpl := ircTpl
+	ircTplLock.RUnlock()
+
 	w := new(bytes.Buffer)
-	if err := ircTpl.ExecuteTemplate(w, name, data); err != nil {
+	if err := tpl.ExecuteTemplate(w, name, data); err != nil {
 		return "", err
 	}
 	s := w.String()
@@ -34,3 +34,21 @@ func Test_TemplateFuncs_compactnum(t *testing.T) {
 	assert.Equal(t, "1M", f(999999))
 	assert.Equal(t, "1M", f(1000000))
 }
+
+func Test_Template_LinkInfo_SearchResult(t *testing.T) {
+	s, err := tplString("link-info", map[string]interface{}{
+		"Title":          "Some video",
+		"ShortUrl":       "https://youtu.be/abc",
+		"IsSearchResult": true,
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, s, "Some video")
+	assert.Contains(t, s, "https://youtu.be/abc")
+
+	s, err = tplString("link-info", map[string]interface{}{
+		"Title": "Some video",
+		"Url":   "https://soundcloud.com/someone/some-track",
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, s, "soundcloud.com")
+}
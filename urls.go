@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+	"mvdan.cc/xurls"
+)
+
+// fileExtensionTLDs contains top-level domains that are also common file
+// extensions. Links without a scheme to such domains are only accepted if
+// they contain a path or start with "www.".
+var fileExtensionTLDs = map[string]bool{
+	"ac":  true,
+	"ai":  true,
+	"am":  true,
+	"as":  true,
+	"bz":  true,
+	"cc":  true,
+	"cl":  true,
+	"cs":  true,
+	"do":  true,
+	"in":  true,
+	"la":  true,
+	"md":  true,
+	"mk":  true,
+	"ml":  true,
+	"mo":  true,
+	"mov": true,
+	"ms":  true,
+	"pl":  true,
+	"pm":  true,
+	"pro": true,
+	"ps":  true,
+	"py":  true,
+	"rs":  true,
+	"sc":  true,
+	"sh":  true,
+	"so":  true,
+	"tf":  true,
+	"zip": true,
+}
+
+// linkFinder finds links in messages.
+type linkFinder struct {
+	// Strict only accepts links with an explicit scheme such as "https://".
+	Strict bool
+
+	// OptOuts describes how users can keep us from previewing links.
+	OptOuts *optOuts
+}
+
+// Find returns the first link in the message that users did not opt out of
+// having previewed, or an empty string.
+func (f *linkFinder) Find(msg string) string {
+	if f.OptOuts != nil && f.OptOuts.MessageOptedOut(msg) {
+		return ""
+	}
+	for _, loc := range xurls.Relaxed.FindAllStringIndex(msg, -1) {
+		link := trimLinkSuffix(msg[loc[0]:loc[1]])
+		if loc[0] > 0 && msg[loc[0]-1] == '@' && !hasScheme(link) {
+			// Domain of an e-mail address or fediverse handle
+			continue
+		}
+		if f.OptOuts != nil && f.OptOuts.URLOptedOut(msg, loc[0], loc[0]+len(link)) {
+			continue
+		}
+		if hasScheme(link) {
+			return link
+		}
+		if !f.Strict && isPlausibleSchemelessLink(link) {
+			return link
+		}
+	}
+	return ""
+}
+
+// hasScheme checks whether the link starts with a scheme like "https://" or
+// "mailto:".
+func hasScheme(link string) bool {
+	i := strings.IndexRune(link, ':')
+	if i < 1 {
+		return false
+	}
+	for j, r := range link[:i] {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (j == 0 || !strings.ContainsRune("0123456789+-.", r)) {
+			return false
+		}
+	}
+	// Don't take "example.com:8080" for a scheme
+	return strings.HasPrefix(link[i+1:], "//") || !strings.ContainsRune(link[:i], '.')
+}
+
+// isPlausibleSchemelessLink checks whether a link without a scheme points to
+// a domain that actually exists on the internet, so that things like file
+// names are not taken for links.
+func isPlausibleSchemelessLink(link string) bool {
+	host, path := link, ""
+	if i := strings.IndexAny(link, "/?#"); i >= 0 {
+		host, path = link[:i], link[i:]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	// IP addresses are only accepted with a scheme
+	if net.ParseIP(host) != nil || !strings.ContainsRune(host, '.') {
+		return false
+	}
+
+	// Only accept domains whose public suffix is actually known. Unknown
+	// top-level domains are reported as not managed by ICANN and without a
+	// dot, while private suffixes like github.io always contain one.
+	suffix, icann := publicsuffix.PublicSuffix(host)
+	if !icann && !strings.ContainsRune(suffix, '.') {
+		return false
+	}
+	if suffix == host {
+		return false
+	}
+
+	tld := suffix[strings.LastIndex(suffix, ".")+1:]
+	if fileExtensionTLDs[tld] && len(strings.Trim(path, "/")) == 0 && !strings.HasPrefix(host, "www.") {
+		return false
+	}
+	return true
+}
+
+// trimLinkSuffix removes punctuation from the end of a link that most likely
+// belongs to the surrounding text, keeping closing brackets that have a
+// matching opening one in the link.
+func trimLinkSuffix(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+		switch last {
+		case '.', ',', ':', ';', '!', '?', '\'', '"':
+			link = link[:len(link)-1]
+			continue
+		case ')', ']', '}':
+			opening := map[byte]string{')': "(", ']': "[", '}': "{"}[last]
+			if strings.Count(link, opening) < strings.Count(link, string(last)) {
+				link = link[:len(link)-1]
+				continue
+			}
+		}
+		break
+	}
+	return link
+}
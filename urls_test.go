@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LinkFinder(t *testing.T) {
+	f := &linkFinder{}
+
+	assert.Equal(t, "https://example.com", f.Find("look at https://example.com"))
+	assert.Equal(t, "example.com", f.Find("look at example.com, it's great"))
+	assert.Equal(t, "foo.github.io/bar", f.Find("see foo.github.io/bar"))
+	assert.Equal(t, "www.example.co.uk", f.Find("go to www.example.co.uk."))
+
+	// Things that look like domains but are none
+	assert.Empty(t, f.Find("edit config.yaml and main.go"))
+	assert.Empty(t, f.Find("released v1.2.3"))
+	assert.Empty(t, f.Find("read README.md and run install.sh"))
+	assert.Empty(t, f.Find("run script.pl now"))
+	assert.Empty(t, f.Find("link against libc.so"))
+	assert.Empty(t, f.Find("edit main.cc"))
+	assert.Empty(t, f.Find("compile file.ml"))
+	assert.Empty(t, f.Find("open Program.cs and model.ai"))
+	assert.Equal(t, "example.ca", f.Find("see example.ca"))
+	assert.Equal(t, "example.xyz", f.Find("see example.xyz"))
+	assert.Equal(t, "www.example.pl", f.Find("see www.example.pl"))
+	assert.Equal(t, "example.pl/page", f.Find("see example.pl/page"))
+	assert.Empty(t, f.Find("ping 10.0.0.1:8080"))
+	assert.Equal(t, "example.sh/install", f.Find("curl example.sh/install"))
+	assert.Equal(t, "http://10.0.0.1:8080", f.Find("open http://10.0.0.1:8080"))
+	assert.Empty(t, f.Find("mail me at user@example.com"))
+	assert.Empty(t, f.Find("follow @user@mastodon.social"))
+
+	// Punctuation and brackets
+	assert.Equal(t, "https://en.wikipedia.org/wiki/Go_(programming_language)",
+		f.Find("(see https://en.wikipedia.org/wiki/Go_(programming_language))."))
+	assert.Equal(t, "https://example.com/test", f.Find("look at https://example.com/test!"))
+	assert.Equal(t, "example.com/path", f.Find("(example.com/path)"))
+
+	// Strict mode
+	f.Strict = true
+	assert.Empty(t, f.Find("look at example.com"))
+	assert.Equal(t, "https://example.com", f.Find("example.com or https://example.com"))
+}
+
+func Test_TrimLinkSuffix(t *testing.T) {
+	assert.Equal(t, "https://example.com/a_(b)", trimLinkSuffix("https://example.com/a_(b)"))
+	assert.Equal(t, "https://example.com/a", trimLinkSuffix("https://example.com/a)."))
+	assert.Equal(t, "https://example.com/[x]", trimLinkSuffix("https://example.com/[x]]"))
+	assert.Equal(t, "https://example.com/?q=1", trimLinkSuffix("https://example.com/?q=1\"';"))
+}
+
+func Test_HasScheme(t *testing.T) {
+	assert.True(t, hasScheme("https://example.com"))
+	assert.True(t, hasScheme("mailto:user@example.com"))
+	assert.False(t, hasScheme("example.com:8080/path"))
+	assert.False(t, hasScheme("example.com"))
+	assert.False(t, hasScheme("://example.com"))
+}
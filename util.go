@@ -30,6 +30,37 @@ func stripIrcFormatting(text string) string {
 	return rxIrcColor.ReplaceAllLiteralString(text, "")
 }
 
+// matchMask checks whether the given text matches an IRC-style wildcard
+// mask, where * matches any amount of characters and ? matches exactly one
+// character. The comparison uses the server's case mapping.
+func matchMask(mask string, text string) bool {
+	m := []rune(foldName(mask))
+	t := []rune(foldName(text))
+
+	mi, ti := 0, 0
+	starMi, starTi := -1, 0
+	for ti < len(t) {
+		switch {
+		case mi < len(m) && (m[mi] == '?' || m[mi] == t[ti]):
+			mi++
+			ti++
+		case mi < len(m) && m[mi] == '*':
+			starMi, starTi = mi, ti
+			mi++
+		case starMi >= 0:
+			// Let the last star consume one more character
+			starTi++
+			mi, ti = starMi+1, starTi
+		default:
+			return false
+		}
+	}
+	for mi < len(m) && m[mi] == '*' {
+		mi++
+	}
+	return mi == len(m)
+}
+
 const (
 	runeCTCPDelimiter      = '\x01'
 	runeCTCPParamDelimiter = ' '
@@ -38,7 +69,8 @@ const (
 var (
 	rxCTCP = regexp.MustCompile(`^` +
 		string(runeCTCPDelimiter) +
-		`([^` + string(runeCTCPParamDelimiter) + `]+)(` + string(runeCTCPParamDelimiter) + `.+)` + // not using \s is intentional here
+		`([^` + string(runeCTCPParamDelimiter) + string(runeCTCPDelimiter) + `]+)` +
+		`(?:` + string(runeCTCPParamDelimiter) + `([^` + string(runeCTCPDelimiter) + `]*))?` + // not using \s is intentional here
 		string(runeCTCPDelimiter) + `?` +
 		`$`)
 )
@@ -70,7 +102,7 @@ func parseCTCP(msg string) (parsedMessage *ctcpMessage, ok bool) {
 	parsedMessage = &ctcpMessage{}
 
 	parsedMessage.Command = matches[1]
-	if len(matches) > 2 {
+	if len(matches[2]) > 0 {
 		parsedMessage.Params = strings.Split(matches[2], string(runeCTCPParamDelimiter))
 	} else {
 		parsedMessage.Params = []string{}
@@ -0,0 +1,24 @@
+package domains
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Normalize brings a domain name into the form we compare with, that is
+// lowercase punycode without a trailing dot.
+func Normalize(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if ascii, err := idna.Punycode.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+	return domain
+}
+
+// IsSubdomain checks whether host is the given domain or a subdomain of it.
+func IsSubdomain(domain, host string) bool {
+	domain = Normalize(domain)
+	host = Normalize(host)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
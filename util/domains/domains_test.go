@@ -0,0 +1,20 @@
+package domains
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Normalize(t *testing.T) {
+	assert.Equal(t, "example.com", Normalize("Example.COM."))
+	assert.Equal(t, "xn--bcher-kva.example", Normalize("Bücher.example"))
+}
+
+func Test_IsSubdomain(t *testing.T) {
+	assert.True(t, IsSubdomain("example.com", "example.com"))
+	assert.True(t, IsSubdomain("example.com", "www.Example.com."))
+	assert.True(t, IsSubdomain("bücher.example", "www.xn--bcher-kva.example"))
+	assert.False(t, IsSubdomain("example.com", "badexample.com"))
+	assert.False(t, IsSubdomain("www.example.com", "example.com"))
+}
@@ -0,0 +1,293 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/icedream/irc-medialink/util/domains"
+	"github.com/icedream/irc-medialink/util/netguard"
+)
+
+// User agent policies
+const (
+	// UserAgentDefault sends the configured user agent only with requests
+	// that do not set their own.
+	UserAgentDefault = "default"
+
+	// UserAgentOverride sends the configured user agent with all requests.
+	UserAgentOverride = "override"
+)
+
+// ErrUnsupportedProxy is returned when the proxy URL uses an unsupported
+// scheme.
+var ErrUnsupportedProxy = errors.New("unsupported proxy scheme, expected http, https or socks5")
+
+// Config contains the settings for all HTTP clients.
+type Config struct {
+	// Timeout limits the time a whole request may take including reading
+	// the response body, zero means no limit. Parsing is limited by the
+	// parse timeout anyway.
+	Timeout time.Duration
+	// DialTimeout limits the time it may take to connect.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout limits the time the TLS handshake may take.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits the time to wait for the response headers
+	// after sending a request, zero means no limit.
+	ResponseHeaderTimeout time.Duration
+
+	// Proxy is the URL of the proxy to use for all requests, such as
+	// http://proxy:3128 or socks5://proxy:1080. SOCKS5 proxies resolve host
+	// names themselves. No proxy is used if nil.
+	Proxy *url.URL
+
+	// CABundle is the path to a PEM file containing certificate authorities
+	// to trust in addition to the system ones.
+	CABundle string
+
+	// Headers contains headers to send to the given domains and their
+	// subdomains.
+	Headers map[string]http.Header
+
+	// MaxIdleConns limits the idle connections kept open overall.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost limits the idle connections kept open to each host.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the connections to each host, zero means no
+	// limit.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long idle connections are kept open.
+	IdleConnTimeout time.Duration
+
+	// UserAgent is sent according to UserAgentPolicy if not empty.
+	UserAgent string
+	// UserAgentPolicy is UserAgentDefault or UserAgentOverride.
+	UserAgentPolicy string
+
+	// Guard checks the addresses of untrusted requests, such as links posted
+	// by users. If nil, all addresses are allowed.
+	Guard *netguard.Guard
+}
+
+// DefaultConfig returns the settings used if nothing is configured, which
+// match the ones of http.DefaultTransport.
+func DefaultConfig() Config {
+	return Config{
+		DialTimeout:         30 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: http.DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		UserAgentPolicy:     UserAgentDefault,
+	}
+}
+
+// Factory hands out HTTP clients sharing the same settings and connection
+// pools.
+type Factory struct {
+	config    Config
+	transport http.RoundTripper
+	untrusted http.RoundTripper
+	base      []*http.Transport
+}
+
+// NewFactory creates a factory for HTTP clients using the given settings.
+func NewFactory(config Config) (*Factory, error) {
+	if config.Proxy != nil {
+		switch strings.ToLower(config.Proxy.Scheme) {
+		case "http", "https", "socks5":
+		default:
+			return nil, ErrUnsupportedProxy
+		}
+	}
+
+	var rootCAs *x509.CertPool
+	if len(config.CABundle) > 0 {
+		pem, err := os.ReadFile(config.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		if rootCAs, err = x509.SystemCertPool(); err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CABundle)
+		}
+	}
+
+	f := &Factory{config: config}
+	dialer := &net.Dialer{
+		Timeout:   config.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	trusted := f.newTransport(rootCAs)
+	trusted.DialContext = dialer.DialContext
+	f.transport = f.wrap(trusted)
+
+	untrusted := f.newTransport(rootCAs)
+	switch {
+	case config.Guard == nil:
+		untrusted.DialContext = dialer.DialContext
+		f.untrusted = f.wrap(untrusted)
+	case config.Proxy != nil:
+		// We only ever connect to the proxy, so the target host has to be
+		// checked before sending the request instead
+		untrusted.DialContext = dialer.DialContext
+		f.untrusted = &guardedTransport{
+			guard: config.Guard,
+			next:  f.wrap(untrusted),
+		}
+	default:
+		untrusted.DialContext = config.Guard.WrapDialer(dialer)
+		f.untrusted = f.wrap(untrusted)
+	}
+
+	// Parsers use the transports directly as well, so the timeout can't be
+	// left to the clients
+	if config.Timeout > 0 {
+		f.transport = &timeoutTransport{timeout: config.Timeout, next: f.transport}
+		f.untrusted = &timeoutTransport{timeout: config.Timeout, next: f.untrusted}
+	}
+	return f, nil
+}
+
+// Transport returns the transport to use for requests to fixed API
+// endpoints.
+func (f *Factory) Transport() http.RoundTripper {
+	return f.transport
+}
+
+// Client returns a client to use for requests to fixed API endpoints.
+func (f *Factory) Client() *http.Client {
+	return &http.Client{Transport: f.transport}
+}
+
+// UntrustedTransport returns the transport to use for requests to URLs
+// users gave us, which checks addresses using the configured guard.
+func (f *Factory) UntrustedTransport() http.RoundTripper {
+	return f.untrusted
+}
+
+// UntrustedClient returns a client to use for requests to URLs users gave
+// us, which checks addresses using the configured guard.
+func (f *Factory) UntrustedClient() *http.Client {
+	return &http.Client{Transport: f.untrusted}
+}
+
+// CloseIdleConnections closes the idle connections of all clients.
+func (f *Factory) CloseIdleConnections() {
+	for _, t := range f.base {
+		t.CloseIdleConnections()
+	}
+}
+
+func (f *Factory) newTransport(rootCAs *x509.CertPool) *http.Transport {
+	t := &http.Transport{
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   f.config.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: f.config.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConns:          f.config.MaxIdleConns,
+		MaxIdleConnsPerHost:   f.config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       f.config.MaxConnsPerHost,
+		IdleConnTimeout:       f.config.IdleConnTimeout,
+	}
+	// Unlike http.DefaultTransport we never use proxies from the environment,
+	// the guard would not check requests sent through them
+	if f.config.Proxy != nil {
+		t.Proxy = http.ProxyURL(f.config.Proxy)
+	}
+	if rootCAs != nil {
+		t.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+	f.base = append(f.base, t)
+	return t
+}
+
+// wrap adds the configured headers to requests sent via the transport.
+func (f *Factory) wrap(t http.RoundTripper) http.RoundTripper {
+	if len(f.config.UserAgent) == 0 && len(f.config.Headers) == 0 {
+		return t
+	}
+	return &headerTransport{config: &f.config, next: t}
+}
+
+// headerTransport adds the user agent and per-domain headers to requests.
+type headerTransport struct {
+	config *Config
+	next   http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Round trippers must not modify the original request
+	req = req.Clone(req.Context())
+	if len(t.config.UserAgent) > 0 &&
+		(t.config.UserAgentPolicy == UserAgentOverride || len(req.Header.Get("User-Agent")) == 0) {
+		req.Header.Set("User-Agent", t.config.UserAgent)
+	}
+	for domain, headers := range t.config.Headers {
+		if !domains.IsSubdomain(domain, req.URL.Hostname()) {
+			continue
+		}
+		for name, values := range headers {
+			req.Header[name] = values
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// guardedTransport checks the target host of requests before sending them
+// through a proxy.
+type guardedTransport struct {
+	guard *netguard.Guard
+	next  http.RoundTripper
+}
+
+func (t *guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.guard.CheckHost(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// timeoutTransport limits the time requests may take including reading the
+// response body, like http.Client.Timeout does for a single request.
+type timeoutTransport struct {
+	timeout time.Duration
+	next    http.RoundTripper
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the context of a request once its response body is
+// closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
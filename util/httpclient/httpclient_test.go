@@ -0,0 +1,207 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/icedream/irc-medialink/util/netguard"
+)
+
+func Test_Factory_Headers(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.UserAgent = "TestBot/1.0"
+	config.Headers = map[string]http.Header{
+		"127.0.0.1":   {"X-Token": {"abc"}},
+		"example.com": {"X-Other": {"def"}},
+	}
+	f, err := NewFactory(config)
+	require.NoError(t, err)
+
+	resp, err := f.Client().Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	headers := <-received
+	assert.Equal(t, "TestBot/1.0", headers.Get("User-Agent"))
+	assert.Equal(t, "abc", headers.Get("X-Token"))
+	assert.Empty(t, headers.Get("X-Other"))
+
+	// Parsers may send their own user agent unless we override it
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "Parser/2.0")
+	resp, err = f.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Parser/2.0", (<-received).Get("User-Agent"))
+	assert.Equal(t, "Parser/2.0", req.Header.Get("User-Agent"))
+
+	config.UserAgentPolicy = UserAgentOverride
+	f, err = NewFactory(config)
+	require.NoError(t, err)
+	resp, err = f.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "TestBot/1.0", (<-received).Get("User-Agent"))
+}
+
+func Test_Factory_Guard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Guard, _ = netguard.New(nil, nil)
+	f, err := NewFactory(config)
+	require.NoError(t, err)
+
+	// Only requests to URLs given by users are checked
+	resp, err := f.Client().Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	var blockedErr *netguard.BlockedError
+	_, err = f.UntrustedClient().Get(server.URL)
+	assert.True(t, errors.As(err, &blockedErr), "unexpected error: %v", err)
+}
+
+func Test_Factory_Proxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	config := DefaultConfig()
+	config.Proxy, _ = url.Parse(proxy.URL)
+	config.Guard, _ = netguard.New(nil, []string{"allowed.test"})
+	f, err := NewFactory(config)
+	require.NoError(t, err)
+
+	// The proxy itself may be internal, but the target host is checked
+	resp, err := f.UntrustedClient().Get("http://allowed.test/page")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "http://allowed.test/page", <-proxied)
+
+	var blockedErr *netguard.BlockedError
+	_, err = f.UntrustedClient().Get("http://127.0.0.1/admin")
+	assert.True(t, errors.As(err, &blockedErr), "unexpected error: %v", err)
+
+	config.Proxy, _ = url.Parse("ftp://proxy:21")
+	_, err = NewFactory(config)
+	assert.ErrorIs(t, err, ErrUnsupportedProxy)
+	config.Proxy, _ = url.Parse("socks5h://proxy:1080")
+	_, err = NewFactory(config)
+	assert.ErrorIs(t, err, ErrUnsupportedProxy)
+}
+
+func Test_Factory_EnvironmentProxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("http_proxy", proxy.URL)
+
+	config := DefaultConfig()
+	config.Guard, _ = netguard.New(nil, nil)
+	f, err := NewFactory(config)
+	require.NoError(t, err)
+	for _, transport := range f.base {
+		assert.Nil(t, transport.Proxy)
+	}
+
+	// Requests are not sent through the proxy, so the guard still applies
+	var blockedErr *netguard.BlockedError
+	_, err = f.UntrustedClient().Get("http://127.0.0.1/admin")
+	assert.True(t, errors.As(err, &blockedErr), "unexpected error: %v", err)
+	assert.Empty(t, proxied)
+}
+
+func Test_Factory_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/body" {
+			// Send the headers right away but never finish the body
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := DefaultConfig()
+	config.Timeout = 100 * time.Millisecond
+	f, err := NewFactory(config)
+	require.NoError(t, err)
+
+	// The timeout also applies to parsers using the transports directly
+	for _, transport := range []http.RoundTripper{f.Transport(), f.UntrustedTransport()} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/headers", nil)
+		require.NoError(t, err)
+		_, err = transport.RoundTrip(req)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		req, err = http.NewRequest(http.MethodGet, server.URL+"/body", nil)
+		require.NoError(t, err)
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		resp.Body.Close()
+	}
+}
+
+func Test_Factory_CABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	f, err := NewFactory(DefaultConfig())
+	require.NoError(t, err)
+	_, err = f.Client().Get(server.URL)
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.CABundle = filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(config.CABundle, []byte("no certificates here"), 0o600))
+	_, err = NewFactory(config)
+	assert.Error(t, err)
+
+	cert := server.Certificate()
+	require.NoError(t, os.WriteFile(config.CABundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600))
+	f, err = NewFactory(config)
+	require.NoError(t, err)
+	resp, err := f.Client().Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
@@ -0,0 +1,191 @@
+package netguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// reservedNetworks contains ranges that are not reachable on the public
+// internet but are not covered by the checks of the net package.
+var reservedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"100.64.0.0/10",  // carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved, including broadcast
+	"64:ff9b:1::/48", // local-use IPv4/IPv6 translation
+	"2001:db8::/32",  // documentation
+	"fec0::/10",      // deprecated site-local
+)
+
+// nat64Network contains IPv6 addresses that are translated to the IPv4
+// address in their last four bytes.
+var nat64Network = mustParseCIDRs("64:ff9b::/96")[0]
+
+// BlockedError is returned when a connection to an internal address has
+// been refused.
+type BlockedError struct {
+	IP net.IP
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("refusing to connect to internal address %s", e.IP)
+}
+
+// Guard refuses connections to loopback, private, link-local and other
+// internal addresses so that users can not make us fetch internal resources.
+// Addresses are checked after DNS resolution for every single connection,
+// which includes connections made when following redirects.
+type Guard struct {
+	blocked      []*net.IPNet
+	allowed      []*net.IPNet
+	allowedHosts map[string]bool
+}
+
+// New creates a guard that additionally refuses connections to the given
+// networks in CIDR notation. Entries of allowed may be networks, addresses or
+// host names, connections to them are never refused.
+func New(blocked []string, allowed []string) (*Guard, error) {
+	g := &Guard{
+		allowedHosts: map[string]bool{},
+	}
+	for _, cidr := range blocked {
+		n, err := parseNetwork(cidr)
+		if err != nil {
+			return nil, err
+		}
+		g.blocked = append(g.blocked, n)
+	}
+	for _, entry := range allowed {
+		if n, err := parseNetwork(entry); err == nil {
+			g.allowed = append(g.allowed, n)
+		} else {
+			g.allowedHosts[normalizeHost(entry)] = true
+		}
+	}
+	return g, nil
+}
+
+// IsAllowedIP checks whether connections to the given address are allowed.
+func (g *Guard) IsAllowedIP(ip net.IP) bool {
+	for _, n := range g.allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	if nat64Network.Contains(ip) {
+		return g.IsAllowedIP(ip[net.IPv6len-net.IPv4len:])
+	}
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, networks := range [][]*net.IPNet{reservedNetworks, g.blocked} {
+		for _, n := range networks {
+			if n.Contains(ip) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// DialContext connects to the given address like net.Dialer.DialContext,
+// refusing to connect to internal addresses unless the host has been
+// allowed explicitly.
+func (g *Guard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return g.WrapDialer(&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})(ctx, network, address)
+}
+
+// WrapDialer returns a function connecting using the given dialer like
+// DialContext does.
+func (g *Guard) WrapDialer(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	guarded := *dialer
+	guarded.Control = g.control
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if g.allowedHosts[normalizeHost(host)] {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
+
+// CheckHost resolves the given host and checks whether connections to all of
+// its addresses are allowed. This is meant for requests sent through a proxy,
+// where we do not connect to the host ourselves.
+func (g *Guard) CheckHost(ctx context.Context, host string) error {
+	if g.allowedHosts[normalizeHost(host)] {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !g.IsAllowedIP(addr.IP) {
+			return &BlockedError{IP: addr.IP}
+		}
+	}
+	return nil
+}
+
+// control is called with the resolved address right before connecting.
+func (g *Guard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("unexpected address %s", address)
+	}
+	if !g.IsAllowedIP(ip) {
+		return &BlockedError{IP: ip}
+	}
+	return nil
+}
+
+// parseNetwork parses a network in CIDR notation or a single address.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = n
+	}
+	return networks
+}
@@ -0,0 +1,93 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Guard_IsAllowedIP(t *testing.T) {
+	g, err := New([]string{"203.0.113.0/24"}, []string{"10.1.2.0/24", "fd00::1"})
+	require.NoError(t, err)
+
+	for _, s := range []string{
+		"127.0.0.1",
+		"::1",
+		"10.0.0.1",
+		"172.16.5.4",
+		"192.168.1.1",
+		"169.254.169.254",
+		"fe80::1",
+		"fd00::2",
+		"0.0.0.0",
+		"100.64.0.1",
+		"::ffff:127.0.0.1",
+		"64:ff9b::a9fe:a9fe",
+		"203.0.113.7",
+	} {
+		assert.False(t, g.IsAllowedIP(net.ParseIP(s)), s)
+	}
+
+	for _, s := range []string{
+		"8.8.8.8",
+		"2606:4700:4700::1111",
+		"64:ff9b::808:808",
+		"10.1.2.3",
+		"fd00::1",
+	} {
+		assert.True(t, g.IsAllowedIP(net.ParseIP(s)), s)
+	}
+
+	_, err = New([]string{"not a network"}, nil)
+	assert.Error(t, err)
+}
+
+func Test_Guard_DialContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	g, err := New(nil, nil)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{DialContext: g.DialContext}}
+	_, err = client.Get(server.URL)
+	var blockedErr *BlockedError
+	require.True(t, errors.As(err, &blockedErr), "unexpected error: %v", err)
+	assert.True(t, blockedErr.IP.IsLoopback())
+
+	// Host names are resolved before checking
+	_, err = client.Get("http://localhost:" + u.Port())
+	assert.True(t, errors.As(err, &blockedErr), "unexpected error: %v", err)
+
+	// Allowed networks and host names
+	for _, allowed := range []string{"127.0.0.0/8", "localhost"} {
+		g, err = New(nil, []string{allowed})
+		require.NoError(t, err)
+		client = &http.Client{Transport: &http.Transport{DialContext: g.DialContext}}
+		resp, err := client.Get("http://localhost:" + u.Port())
+		require.NoError(t, err, allowed)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+}
+
+func Test_Guard_CheckHost(t *testing.T) {
+	g, err := New(nil, []string{"allowed.localhost"})
+	require.NoError(t, err)
+
+	var blockedErr *BlockedError
+	assert.True(t, errors.As(g.CheckHost(context.Background(), "127.0.0.1"), &blockedErr))
+	assert.True(t, errors.As(g.CheckHost(context.Background(), "localhost"), &blockedErr))
+	assert.NoError(t, g.CheckHost(context.Background(), "8.8.8.8"))
+	assert.NoError(t, g.CheckHost(context.Background(), "Allowed.Localhost."))
+}
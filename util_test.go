@@ -1,5 +1,49 @@
 package main
 
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
 // TODO - unit test stripIrcFormatting
 
-// TODO - unit test parseCTCP
+func Test_MatchMask(t *testing.T) {
+	assert.True(t, matchMask("*", ""))
+	assert.True(t, matchMask("*", "anything"))
+	assert.True(t, matchMask("*bot", "LinkBot"))
+	assert.True(t, matchMask("*Bot*", "botnet"))
+	assert.True(t, matchMask("nick?", "NICK1"))
+	assert.True(t, matchMask("[away]*", "{AWAY}nick"))
+	assert.True(t, matchMask("*!*@*.example.com", "nick!user@host.example.com"))
+	assert.True(t, matchMask("a*b*c", "aXXbYYbc"))
+	assert.False(t, matchMask("nick?", "nick"))
+	assert.False(t, matchMask("*bot", "bottle"))
+	assert.False(t, matchMask("*!*@*.example.com", "nick!user@example.org"))
+	assert.False(t, matchMask("", "nick"))
+}
+
+func Test_ParseCTCP(t *testing.T) {
+	msg, ok := parseCTCP("\x01VERSION\x01")
+	require.True(t, ok)
+	assert.Equal(t, "VERSION", msg.Command)
+	assert.Empty(t, msg.Params)
+
+	msg, ok = parseCTCP("\x01PING 1234 5678\x01")
+	require.True(t, ok)
+	assert.Equal(t, "PING", msg.Command)
+	assert.Equal(t, []string{"1234", "5678"}, msg.Params)
+	assert.Equal(t, "1234 5678", msg.ParamLine())
+	assert.Equal(t, "\x01PING 1234 5678\x01", msg.String())
+
+	// Some clients leave out the closing delimiter
+	msg, ok = parseCTCP("\x01TIME")
+	require.True(t, ok)
+	assert.Equal(t, "TIME", msg.Command)
+
+	_, ok = parseCTCP("VERSION")
+	assert.False(t, ok)
+	_, ok = parseCTCP("\x01\x01")
+	assert.False(t, ok)
+}